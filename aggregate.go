@@ -0,0 +1,274 @@
+package simpledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Stats are the statistics of the number values of a field.
+type Stats struct {
+	// Count is the number of number values.
+	Count uint64
+	// Sum is the sum of the values.
+	Sum float64
+	// Min is the min value. It's 0 if Count is 0.
+	Min float64
+	// Max is the max value. It's 0 if Count is 0.
+	Max float64
+	// Avg is the average of the values. It's 0 if Count is 0.
+	Avg float64
+}
+
+// add adds a number value to the stats.
+func (s *Stats) add(f float64) {
+	if s.Count == 0 || f < s.Min {
+		s.Min = f
+	}
+
+	if s.Count == 0 || f > s.Max {
+		s.Max = f
+	}
+
+	s.Count++
+	s.Sum += f
+	s.Avg = s.Sum / float64(s.Count)
+}
+
+// AggregateOptions are the options of Aggregate().
+type AggregateOptions struct {
+	// Fields are the fields to compute stats of. Nested fields are separated by ".".
+	// Each item is counted if the value is an array. Values which are not numbers are ignored.
+	Fields []string
+	// GroupBy is the field to group records by. Records are not grouped if it's empty.
+	GroupBy string
+}
+
+// AggregateResult is the result of Aggregate().
+type AggregateResult struct {
+	// Count is the number of records.
+	Count uint64
+	// Stats are the stats of the fields. Key: field.
+	Stats map[string]Stats
+	// Groups are the results of the records of each value of the GroupBy field.
+	// Key: string value, or the text of number and bool values(Ex: "25", "true").
+	// Numbers are normalized so that equal numbers are in the same group(Ex: 25, 25.0 and 2.5e1 are in "25").
+	// Records without the value are not in any group, and a record is in more than one group if the value is an array.
+	// The number of groups is the number of distinct values. It's nil if GroupBy is empty.
+	Groups map[string]*AggregateResult
+}
+
+// newAggregateResult creates an empty result with zero stats of the fields.
+func newAggregateResult(fields []string) *AggregateResult {
+	r := &AggregateResult{Stats: make(map[string]Stats)}
+	for _, field := range fields {
+		r.Stats[field] = Stats{}
+	}
+	return r
+}
+
+// add adds the decoded JSON value of a record to the result.
+func (r *AggregateResult) add(v interface{}, fields []string) {
+	r.Count++
+	for _, field := range fields {
+		s := r.Stats[field]
+		for _, fv := range getFieldValues(v, field) {
+			if n, ok := fv.(json.Number); ok {
+				if f, err := n.Float64(); err == nil {
+					s.add(f)
+				}
+			}
+		}
+		r.Stats[field] = s
+	}
+}
+
+// addRecord adds the record data to the result and the groups of its values.
+func (r *AggregateResult) addRecord(data string, opts AggregateOptions) {
+	v, _ := decodeJSON(data)
+	r.add(v, opts.Fields)
+
+	if len(opts.GroupBy) == 0 {
+		return
+	}
+
+	for text := range genFieldIndexMembers(fieldIndex{field: opts.GroupBy, kind: IndexCount}, 0, v) {
+		g, ok := r.Groups[text]
+		if !ok {
+			g = newAggregateResult(opts.Fields)
+			r.Groups[text] = g
+		}
+		g.add(v, opts.Fields)
+	}
+}
+
+// aggregateByCounters sets the record count and the group counts of the result by the counters of the IndexCount index.
+// The counters are used only if the index is stored in the meta data, so that all clients maintain them.
+// Record buckets and the counters are read in one transaction. It returns false if the index is not stored.
+func (db *DB) aggregateByCounters(idx fieldIndex, r *AggregateResult) (ok bool, err error) {
+	var ret []interface{}
+	var m map[string]string
+	var maxBucketID, n uint64
+	var count int64
+
+	if ret, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		indexes, err := db.getFieldIndexes()
+		if err != nil {
+			return err
+		}
+
+		ok = false
+		for _, stored := range indexes {
+			if stored == idx {
+				ok = true
+			}
+		}
+
+		if !ok {
+			return nil
+		}
+
+		if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+
+		for i := uint64(1); i <= maxBucketID; i++ {
+			t.send("HLEN", fmt.Sprintf("%v/bucket/%v", db.name, i))
+		}
+		t.send("HGETALL", db.genFieldIndexKey(idx))
+		return nil
+	}); err != nil || !ok {
+		return false, err
+	}
+
+	for _, v := range ret[:len(ret)-1] {
+		if n, err = redis.Uint64(v, nil); err != nil {
+			return false, err
+		}
+		r.Count += n
+	}
+
+	if m, err = redis.StringMap(ret[len(ret)-1], nil); err != nil {
+		return false, err
+	}
+
+	for text, v := range m {
+		if count, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return false, err
+		}
+
+		// Counters of removed values are kept as 0.
+		if count <= 0 {
+			continue
+		}
+		r.Groups[text] = &AggregateResult{Count: uint64(count), Stats: make(map[string]Stats)}
+	}
+	return true, nil
+}
+
+// Aggregate computes the count of records, stats(count, sum, min, max and avg) of number fields
+// and the results of each group of the GroupBy field by reading records.
+// If all records are aggregated, no stats fields are set and the GroupBy field has the index of IndexCount kind(see AddFieldIndex()),
+// the maintained counters and the record count are read in one transaction instead of records.
+//
+//	Params:
+//	    ids: record ids(Ex: results of Search(), TextSearch() or Find()). Redundant ids are removed.
+//	         All records are aggregated if it's nil.
+//	    opts: fields to compute stats of and the field to group by.
+//	Returns:
+//	    result: aggregation result. Records which are not JSON are counted only.
+//	Comments:
+//	    Ex: count per status: Aggregate(nil, AggregateOptions{GroupBy: "status"}),
+//	        sum / avg of amounts per status: Aggregate(nil, AggregateOptions{Fields: []string{"amount"}, GroupBy: "status"}).
+func (db *DB) Aggregate(ids []string, opts AggregateOptions) (result *AggregateResult, err error) {
+	var records []Record
+	if ids != nil {
+		records = idRecords(ids)
+	}
+	hc := db.newHookContext(OpAggregate, records, nil)
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		var hookIDs []string
+		if hc.Records != nil {
+			hookIDs = recordIDs(hc.Records)
+		}
+
+		result, err = db.aggregate(hookIDs, opts)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// aggregate computes the aggregation result of the records or all records if ids is nil.
+func (db *DB) aggregate(ids []string, opts AggregateOptions) (result *AggregateResult, err error) {
+	var records []Record
+	var idx fieldIndex
+	var ok bool
+	var nID uint64
+	set := make(map[uint64]struct{})
+	arr := []string{}
+	result = newAggregateResult(opts.Fields)
+
+	if len(opts.GroupBy) > 0 {
+		result.Groups = make(map[string]*AggregateResult)
+	}
+
+	if ids == nil {
+		// Use the counters if only group counts of all records are needed.
+		if idx, ok = db.findFieldIndex(opts.GroupBy, IndexCount); ok && len(opts.Fields) == 0 && !db.encrypted {
+			if ok, err = db.aggregateByCounters(idx, result); err != nil || ok {
+				goto end
+			}
+		}
+
+		err = db.forEachRecord(func(id uint64, data string) error {
+			result.addRecord(data, opts)
+			return nil
+		})
+		goto end
+	}
+
+	for _, id := range ids {
+		if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			goto end
+		}
+
+		if _, ok = set[nID]; !ok {
+			set[nID] = struct{}{}
+			arr = append(arr, id)
+		}
+	}
+
+	for start := 0; start < len(arr); start += KeyBatchSize {
+		end := start + KeyBatchSize
+		if end > len(arr) {
+			end = len(arr)
+		}
+
+		if records, err = db.batchGet(arr[start:end]); err != nil {
+			goto end
+		}
+
+		for _, r := range records {
+			// The record is deleted after it's searched.
+			if len(r.Data) == 0 {
+				continue
+			}
+			result.addRecord(r.Data, opts)
+		}
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Aggregate() error: %v\n", err)
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,74 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Aggregate() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched []string
+	var result *simpledb.AggregateResult
+
+	log.Printf("\n")
+	log.Printf("--------- Aggregate() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "aggregate-test")
+	defer db.Close()
+
+	// Counters of each status are maintained for group counts of all records.
+	if err = db.AddFieldIndex("status", simpledb.IndexCount); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"no":"A001","status":"paid","amount":100}`,
+		`{"no":"A002","status":"paid","amount":250.5}`,
+		`{"no":"A003","status":"refunded","amount":80}`,
+		`{"no":"A004","status":"new","amount":30}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Count per status by the counters.
+	if result, err = db.Aggregate(nil, simpledb.AggregateOptions{GroupBy: "status"}); err != nil {
+		goto end
+	}
+
+	log.Printf("count: %v\n", result.Count)
+	for status, g := range result.Groups {
+		log.Printf("status: %v, count: %v\n", status, g.Count)
+	}
+
+	// Sum / avg of amounts per status by reading records.
+	if result, err = db.Aggregate(nil, simpledb.AggregateOptions{Fields: []string{"amount"}, GroupBy: "status"}); err != nil {
+		goto end
+	}
+
+	for status, g := range result.Groups {
+		log.Printf("status: %v, amount: %+v\n", status, g.Stats["amount"])
+	}
+
+	// Stats of search results.
+	if matched, err = db.Find(simpledb.Range("amount", "50", "")); err != nil {
+		goto end
+	}
+
+	if result, err = db.Aggregate(matched, simpledb.AggregateOptions{Fields: []string{"amount"}}); err != nil {
+		goto end
+	}
+	log.Printf("amount >= 50: %+v\n", result.Stats["amount"])
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Aggregate() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,423 @@
+package simpledb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ItemStatus represents the status of an item in batch operations.
+type ItemStatus int
+
+const (
+	// ItemCommitted means the item is committed.
+	ItemCommitted ItemStatus = iota
+	// ItemSkipped means the item is skipped because of an error.
+	ItemSkipped
+	// ItemUnchanged means the item is not written because the new data is the same as the current data.
+	ItemUnchanged
+)
+
+// String returns the name of the item status.
+func (s ItemStatus) String() string {
+	switch s {
+	case ItemCommitted:
+		return "committed"
+	case ItemSkipped:
+		return "skipped"
+	case ItemUnchanged:
+		return "unchanged"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+// ItemResult is the result of each item in partial-success batch operations.
+type ItemResult struct {
+	// ID is record ID. It's empty if a record failed to be created.
+	ID string
+	// Status is the item status.
+	Status ItemStatus
+	// Err is the error which causes the item to be skipped.
+	Err error
+}
+
+// parseIDs parses record ids. Error of each id is stored in errs.
+func parseIDs(ids []string) (nIDs []uint64, errs []error) {
+	var nID uint64
+	var err error
+
+	for _, id := range ids {
+		if nID, err = strconv.ParseUint(id, 10, 64); err == nil && nID == 0 {
+			err = fmt.Errorf("Invalid id: %v.", id)
+		}
+		nIDs = append(nIDs, nID)
+		errs = append(errs, err)
+	}
+	return nIDs, errs
+}
+
+// batchCreate creates records in one transaction.
+// IDs of records are generated by the ID generator unless they're supplied by client.
+// Items which fail the checks are skipped if skipFailed is true, otherwise the first error is returned.
+// Records expire after ttl if it's greater than 0.
+func (db *DB) batchCreate(records []Record, skipFailed bool, ttl time.Duration) (results []ItemResult, err error) {
+	dataArr := []string{}
+	keys := []string{db.genMetaKey()}
+
+	for _, r := range records {
+		dataArr = append(dataArr, r.Data)
+	}
+	sizeErrs := db.checkDataSizes(dataArr)
+	validErrs := db.validateAll(dataArr)
+
+	for _, data := range dataArr {
+		if len(data) != 0 {
+			keys = append(keys, db.genIndexHashKey(data))
+		}
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var maxID, maxBucketID, newMaxBucketID, owner, nID uint64
+		var found, ok bool
+		var err, itemErr error
+		checkedData := make(map[string]int) // key: data, value: order in dataArr.
+		usedIDs := make(map[uint64]struct{})
+
+		results = []ItemResult{}
+
+		if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
+			return err
+		}
+
+		if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+
+		newMaxBucketID = maxBucketID
+
+		for i, data := range dataArr {
+			itemErr = nil
+
+			if len(data) == 0 {
+				itemErr = fmt.Errorf("Empty data.")
+			} else if sizeErrs[i] != nil {
+				itemErr = sizeErrs[i]
+			} else if validErrs[i] != nil {
+				itemErr = validErrs[i]
+			} else if _, ok = checkedData[data]; ok {
+				itemErr = fmt.Errorf("Redundant data found in dataArr: %v", data)
+			} else {
+				checkedData[data] = i
+				if owner, found, err = db.getIndexedID(data); err != nil {
+					return err
+				}
+
+				if found {
+					itemErr = &DataExistsError{Data: data, ID: strconv.FormatUint(owner, 10)}
+				}
+			}
+
+			if itemErr == nil {
+				if nID, itemErr, err = db.nextID(records[i].ID, &maxID, usedIDs); err != nil {
+					return err
+				}
+			}
+
+			if itemErr != nil {
+				if !skipFailed {
+					return itemErr
+				}
+				results = append(results, ItemResult{Status: ItemSkipped, Err: itemErr})
+				continue
+			}
+
+			if err = db.queueCreate(t, nID, data); err != nil {
+				return err
+			}
+
+			if ttl > 0 {
+				db.queueExpire(t, nID, ttl)
+			}
+
+			if bucketID := db.computeBucketID(nID); bucketID > newMaxBucketID {
+				newMaxBucketID = bucketID
+			}
+
+			results = append(results, ItemResult{ID: strconv.FormatUint(nID, 10), Status: ItemCommitted})
+		}
+
+		t.send("HSET", db.genMetaKey(), metaFieldMaxID, maxID)
+
+		if newMaxBucketID > maxBucketID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxBucketID, newMaxBucketID)
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchCreate() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	return results, nil
+}
+
+// updateCond is the precondition of updating a record. It's called in the transaction with the current data of the record.
+type updateCond func(id uint64, oldData string) error
+
+// batchUpdate updates records in one transaction.
+// Items which fail the checks or cond(optional) are skipped if skipFailed is true, otherwise the first error is returned.
+func (db *DB) batchUpdate(records []Record, skipFailed bool, cond updateCond) (results []ItemResult, err error) {
+	ids := []string{}
+	dataArr := []string{}
+	keys := []string{}
+
+	for _, r := range records {
+		ids = append(ids, r.ID)
+		dataArr = append(dataArr, r.Data)
+	}
+
+	nIDs, idErrs := parseIDs(ids)
+	sizeErrs := db.checkDataSizes(dataArr)
+	validErrs := db.validateAll(dataArr)
+	for i, r := range records {
+		if idErrs[i] == nil {
+			keys = append(keys, db.genRecordHashKey(nIDs[i]), db.genVersionHashKey(nIDs[i]))
+		}
+
+		if len(r.Data) != 0 {
+			keys = append(keys, db.genIndexHashKey(r.Data))
+		}
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var owner uint64
+		var oldData string
+		var exists, found, ok bool
+		var err, itemErr error
+		checkedIDs := make(map[uint64]int)  // key: id, value: order in records.
+		checkedData := make(map[string]int) // key: data, value: order in records.
+
+		results = []ItemResult{}
+
+		for i, r := range records {
+			itemErr = idErrs[i]
+
+			if itemErr == nil {
+				if _, ok = checkedIDs[nIDs[i]]; ok {
+					itemErr = fmt.Errorf("Redundant id found in records: %v", r.ID)
+				} else if len(r.Data) == 0 {
+					itemErr = fmt.Errorf("Empty data.")
+				} else if sizeErrs[i] != nil {
+					itemErr = sizeErrs[i]
+				} else if validErrs[i] != nil {
+					itemErr = validErrs[i]
+				} else if _, ok = checkedData[r.Data]; ok {
+					itemErr = fmt.Errorf("Redundant data found in records: %v", r.Data)
+				}
+			}
+
+			if itemErr == nil {
+				if oldData, exists, err = db.getRecordData(nIDs[i]); err != nil {
+					return err
+				}
+
+				if owner, found, err = db.getIndexedID(r.Data); err != nil {
+					return err
+				}
+
+				if !exists {
+					itemErr = fmt.Errorf("Id: %v does not exist.", r.ID)
+				} else if found && owner != nIDs[i] {
+					itemErr = &DataExistsError{Data: r.Data, ID: strconv.FormatUint(owner, 10)}
+				} else if cond != nil {
+					itemErr = cond(nIDs[i], oldData)
+				}
+			}
+
+			if itemErr != nil {
+				if !skipFailed {
+					return itemErr
+				}
+				results = append(results, ItemResult{ID: r.ID, Status: ItemSkipped, Err: itemErr})
+				continue
+			}
+
+			checkedIDs[nIDs[i]] = i
+			checkedData[r.Data] = i
+
+			// Updating a record with its current data is a no-op.
+			if oldData == r.Data {
+				results = append(results, ItemResult{ID: r.ID, Status: ItemUnchanged})
+				continue
+			}
+
+			// Watch the index bucket of old data which will be updated.
+			if err = db.watch(db.genIndexHashKey(oldData)); err != nil {
+				return err
+			}
+
+			if err = db.queueUpdate(t, nIDs[i], oldData, r.Data); err != nil {
+				return err
+			}
+			results = append(results, ItemResult{ID: r.ID, Status: ItemCommitted})
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchUpdate() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	return results, nil
+}
+
+// deleteCond is the precondition of deleting a record. It's called in the transaction with the current data of the record.
+type deleteCond func(id uint64, data string) error
+
+// batchDelete deletes records in one transaction.
+// Items which fail the checks or cond(optional) are skipped if skipFailed is true, otherwise the first error is returned.
+// Deleted records are moved to the trash if soft is true.
+func (db *DB) batchDelete(ids []string, skipFailed, soft bool, cond deleteCond) (results []ItemResult, err error) {
+	keys := []string{}
+
+	nIDs, idErrs := parseIDs(ids)
+	for i := range ids {
+		if idErrs[i] == nil {
+			keys = append(keys, db.genRecordHashKey(nIDs[i]))
+		}
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var data string
+		var exists, ok bool
+		var err, itemErr error
+		checkedIDs := make(map[uint64]int) // key: id, value: order in ids.
+
+		results = []ItemResult{}
+
+		for i, id := range ids {
+			itemErr = idErrs[i]
+
+			if itemErr == nil {
+				if _, ok = checkedIDs[nIDs[i]]; ok {
+					itemErr = fmt.Errorf("Redundant id found in ids: %v", id)
+				} else {
+					if data, exists, err = db.getRecordData(nIDs[i]); err != nil {
+						return err
+					}
+
+					if !exists {
+						itemErr = fmt.Errorf("id:%v does not exist", id)
+					} else if soft {
+						// The data is stored in the trash.
+						if itemErr = db.checkDataSize(i, data); itemErr == nil {
+							itemErr, err = db.checkTrashFree(nIDs[i])
+						}
+					}
+
+					if err != nil {
+						return err
+					}
+
+					if itemErr == nil && cond != nil {
+						itemErr = cond(nIDs[i], data)
+					}
+				}
+			}
+
+			if itemErr != nil {
+				if !skipFailed {
+					return itemErr
+				}
+				results = append(results, ItemResult{ID: id, Status: ItemSkipped, Err: itemErr})
+				continue
+			}
+
+			checkedIDs[nIDs[i]] = i
+
+			// Watch the index bucket which will be updated.
+			if err = db.watch(db.genIndexHashKey(data)); err != nil {
+				return err
+			}
+
+			if err = db.queueDelete(t, nIDs[i], data); err != nil {
+				return err
+			}
+
+			if soft {
+				if err = db.queueTrash(t, nIDs[i], data); err != nil {
+					return err
+				}
+			}
+			results = append(results, ItemResult{ID: id, Status: ItemCommitted})
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchDelete() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	return results, nil
+}
+
+// BatchCreatePartial creates records in database and skips the data which fail the checks(empty, redundant or already exist).
+// Valid data are committed in one transaction.
+//
+//	Returns:
+//	    results: per-item results. The order is the same as dataArr.
+func (db *DB) BatchCreatePartial(dataArr []string) (results []ItemResult, err error) {
+	if results, err = db.create(OpBatchCreatePartial, dataRecords(dataArr), true, 0); err != nil {
+		debugPrintf("BatchCreatePartial() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	debugPrintf("BatchCreatePartial() ok. results: %v\n", results)
+	return results, nil
+}
+
+// BatchUpdatePartial updates records in database and skips the records which fail the checks(invalid or missing ID, redundant or duplicate data).
+// Valid records are committed in one transaction. Records with unchanged data are not written.
+//
+//	Returns:
+//	    results: per-item results. The order is the same as records.
+func (db *DB) BatchUpdatePartial(records []Record) (results []ItemResult, err error) {
+	if results, err = db.update(OpBatchUpdatePartial, records, true, nil); err != nil {
+		debugPrintf("BatchUpdatePartial() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	debugPrintf("BatchUpdatePartial() ok. results: %v\n", results)
+	return results, nil
+}
+
+// BatchDeletePartial deletes records in database and skips the IDs which fail the checks(invalid, redundant or missing ID).
+// Valid records are deleted in one transaction. They're moved to the trash in soft-delete mode.
+//
+//	Returns:
+//	    results: per-item results. The order is the same as ids.
+func (db *DB) BatchDeletePartial(ids []string) (results []ItemResult, err error) {
+	if results, err = db.delete(OpBatchDeletePartial, ids, true, db.softDelete, nil); err != nil {
+		debugPrintf("BatchDeletePartial() error: %v\n", err)
+		return []ItemResult{}, err
+	}
+
+	debugPrintf("BatchDeletePartial() ok. results: %v\n", results)
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_BatchCreatePartial() {
+	var err error
+	var db *simpledb.DB
+	ids := []string{}
+	results := []simpledb.ItemResult{}
+	data := []string{
+		`{"name":"Eve","tel":"13900139011"}`,
+		``,
+		`{"name":"Fred","tel":"13900139012"}`,
+		`{"name":"Eve","tel":"13900139011"}`,
+	}
+
+	log.Printf("\n")
+	log.Printf("--------- BatchCreatePartial() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "partial-test")
+	defer db.Close()
+
+	// Empty and redundant data are skipped.
+	if results, err = db.BatchCreatePartial(data); err != nil {
+		goto end
+	}
+
+	for _, r := range results {
+		log.Printf("id: %v, status: %v, error: %v\n", r.ID, r.Status, r.Err)
+		if r.Status == simpledb.ItemCommitted {
+			ids = append(ids, r.ID)
+		}
+	}
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- BatchCreatePartial() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_BatchUpdatePartial() {
+	var err error
+	var db *simpledb.DB
+	ids := []string{}
+	results := []simpledb.ItemResult{}
+	records := []simpledb.Record{}
+
+	log.Printf("\n")
+	log.Printf("--------- BatchUpdatePartial() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "partial-test")
+	defer db.Close()
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Gina","tel":"13900139013"}`,
+		`{"name":"Hank","tel":"13900139014"}`,
+	}); err != nil {
+		goto end
+	}
+
+	records = []simpledb.Record{
+		// Updated.
+		{ID: ids[0], Data: `{"name":"Gina","tel":"18900189013"}`},
+		// Skipped: the data is owned by ids[0].
+		{ID: ids[1], Data: `{"name":"Gina","tel":"18900189013"}`},
+		// Skipped: the id does not exist.
+		{ID: "999999", Data: `{"name":"Ivan","tel":"13900139015"}`},
+	}
+
+	if results, err = db.BatchUpdatePartial(records); err != nil {
+		goto end
+	}
+
+	for _, r := range results {
+		log.Printf("update: id: %v, status: %v, error: %v\n", r.ID, r.Status, r.Err)
+	}
+
+	// "999999" is skipped.
+	if results, err = db.BatchDeletePartial(append(ids, "999999")); err != nil {
+		goto end
+	}
+
+	for _, r := range results {
+		log.Printf("delete: id: %v, status: %v, error: %v\n", r.ID, r.Status, r.Err)
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- BatchUpdatePartial() Test End --------\n")
+	// Output:
+}
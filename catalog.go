@@ -0,0 +1,394 @@
+package simpledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// CatalogKey is the key of the catalog which records all databases in Redis.
+	// It's a hash. Field: database name, value: JSON of the database information.
+	CatalogKey = "simpledb:catalog"
+	// KeyBatchSize is the max number of keys scanned and processed at a time when dropping, renaming or copying databases.
+	KeyBatchSize = 1024
+)
+
+// DBInfo is the information of a database recorded in the catalog.
+type DBInfo struct {
+	// Name is the database name.
+	Name string
+	// CreatedAt is the time when the database is opened at first time.
+	CreatedAt time.Time
+	// Settings are the persistent settings of the database. Ex: "redis-hash-max-ziplist-entries".
+	Settings map[string]string
+}
+
+// catalogEntry is the JSON format of DBInfo stored in the catalog.
+type catalogEntry struct {
+	Name     string            `json:"name"`
+	Created  int64             `json:"created"` // Unix milliseconds.
+	Settings map[string]string `json:"settings"`
+}
+
+// register records the database in the catalog if it's not recorded.
+func (db *DB) register() (err error) {
+	var buf []byte
+	entry := catalogEntry{
+		Name:    db.name,
+		Created: time.Now().UnixMilli(),
+		Settings: map[string]string{
+			"redis-hash-max-ziplist-entries": strconv.FormatUint(db.redisHashMaxZiplistEntries, 10),
+		},
+	}
+
+	if buf, err = json.Marshal(entry); err != nil {
+		return err
+	}
+
+	_, err = db.c.Do("HSETNX", CatalogKey, db.name, buf)
+	return err
+}
+
+// getCatalogEntry gets the catalog entry of given database name. It returns false if the database is not recorded.
+func getCatalogEntry(c redis.Conn, name string) (entry catalogEntry, exists bool, err error) {
+	var buf []byte
+
+	if buf, err = redis.Bytes(c.Do("HGET", CatalogKey, name)); err != nil {
+		if err == redis.ErrNil {
+			return catalogEntry{}, false, nil
+		}
+		return catalogEntry{}, false, err
+	}
+
+	if err = json.Unmarshal(buf, &entry); err != nil {
+		return catalogEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+// escapeGlob escapes the special characters of glob-style pattern in s.
+func escapeGlob(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// scanDBKeys scans the keys of given database and calls fn for each batch of keys.
+// Keys of other databases whose names start with "name/" are excluded.
+func scanDBKeys(c redis.Conn, name string, fn func(keys []string) error) (err error) {
+	var cursor uint64
+	var v []interface{}
+	var names []string
+	var nested []string
+	keys := []string{}
+	batch := []string{}
+	pattern := escapeGlob(name) + "/*"
+
+	if names, err = redis.Strings(c.Do("HKEYS", CatalogKey)); err != nil {
+		return err
+	}
+
+	for _, n := range names {
+		if strings.HasPrefix(n, name+"/") {
+			nested = append(nested, n+"/")
+		}
+	}
+
+	for {
+		if v, err = redis.Values(c.Do("SCAN", cursor, "MATCH", pattern, "COUNT", KeyBatchSize)); err != nil {
+			return err
+		}
+
+		if _, err = redis.Scan(v, &cursor, &keys); err != nil {
+			return err
+		}
+
+		batch = batch[:0]
+	next:
+		for _, k := range keys {
+			for _, prefix := range nested {
+				if strings.HasPrefix(k, prefix) {
+					continue next
+				}
+			}
+			batch = append(batch, k)
+		}
+
+		if len(batch) > 0 {
+			if err = fn(batch); err != nil {
+				return err
+			}
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// dbExists checks if the database is recorded in the catalog or has any key in Redis.
+func dbExists(c redis.Conn, name string) (exists bool, err error) {
+	errFound := fmt.Errorf("found")
+
+	if _, exists, err = getCatalogEntry(c, name); err != nil || exists {
+		return exists, err
+	}
+
+	if err = scanDBKeys(c, name, func(keys []string) error {
+		return errFound
+	}); err != nil {
+		if err == errFound {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// ListDBs returns the databases recorded in the catalog ordered by name.
+func ListDBs(c redis.Conn) (infos []DBInfo, err error) {
+	var m map[string]string
+	var entry catalogEntry
+	names := []string{}
+	infos = []DBInfo{}
+
+	if m, err = redis.StringMap(c.Do("HGETALL", CatalogKey)); err != nil {
+		goto end
+	}
+
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry = catalogEntry{}
+		if err = json.Unmarshal([]byte(m[name]), &entry); err != nil {
+			goto end
+		}
+		infos = append(infos, DBInfo{Name: entry.Name, CreatedAt: time.UnixMilli(entry.Created), Settings: entry.Settings})
+	}
+
+end:
+	if err != nil {
+		debugPrintf("ListDBs() error: %v\n", err)
+		return []DBInfo{}, err
+	}
+
+	return infos, nil
+}
+
+// DropDB deletes the database: all record buckets, index buckets and meta keys, and removes it from the catalog.
+// The database should not be in use. UNLINK is used to free memory in background.
+func DropDB(c redis.Conn, name string) (err error) {
+	if len(name) == 0 {
+		err = fmt.Errorf("Empty db name.")
+		goto end
+	}
+
+	if err = scanDBKeys(c, name, func(keys []string) error {
+		return unlinkKeys(c, keys)
+	}); err != nil {
+		goto end
+	}
+
+	if _, err = c.Do("HDEL", CatalogKey, name); err != nil {
+		goto end
+	}
+
+	debugPrintf("DropDB() ok. name: %v\n", name)
+
+end:
+	if err != nil {
+		debugPrintf("DropDB() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// unlinkKeys deletes keys by UNLINK. It falls back to DEL if UNLINK is not supported(Redis < 4.0).
+func unlinkKeys(c redis.Conn, keys []string) (err error) {
+	args := []interface{}{}
+
+	for _, k := range keys {
+		args = append(args, k)
+	}
+
+	if _, err = c.Do("UNLINK", args...); err != nil {
+		if !strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+			return err
+		}
+		_, err = c.Do("DEL", args...)
+	}
+	return err
+}
+
+// RenameDB renames the database. It fails if the new name is already used.
+// The database should not be in use.
+func RenameDB(c redis.Conn, oldName, newName string) (err error) {
+	var entry catalogEntry
+	var buf []byte
+	exists := false
+
+	if err = checkDBNames(c, oldName, newName); err != nil {
+		goto end
+	}
+
+	if err = scanDBKeys(c, oldName, func(keys []string) error {
+		for _, k := range keys {
+			c.Send("RENAMENX", k, newName+strings.TrimPrefix(k, oldName))
+		}
+
+		if err := c.Flush(); err != nil {
+			return err
+		}
+
+		// Receive all replies before returning the first error to keep the connection usable.
+		var firstErr error
+		for _, k := range keys {
+			// SCAN may return a key more than once. Ignore the error of the key which is already renamed.
+			if _, err := c.Receive(); err != nil && !strings.Contains(err.Error(), "no such key") && firstErr == nil {
+				firstErr = fmt.Errorf("Rename %v error: %v", k, err)
+			}
+		}
+		return firstErr
+	}); err != nil {
+		goto end
+	}
+
+	if entry, exists, err = getCatalogEntry(c, oldName); err != nil {
+		goto end
+	}
+
+	if exists {
+		entry.Name = newName
+		if buf, err = json.Marshal(entry); err != nil {
+			goto end
+		}
+
+		c.Send("MULTI")
+		c.Send("HDEL", CatalogKey, oldName)
+		c.Send("HSET", CatalogKey, newName, buf)
+		if _, err = c.Do("EXEC"); err != nil {
+			goto end
+		}
+	}
+
+	debugPrintf("RenameDB() ok. %v -> %v\n", oldName, newName)
+
+end:
+	if err != nil {
+		debugPrintf("RenameDB() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// CopyDB copies the database to a new database by Redis COPY command(Redis >= 6.2). It fails if the destination name is already used.
+// The source database should not be written during copying.
+func CopyDB(c redis.Conn, srcName, dstName string) (err error) {
+	var entry catalogEntry
+	var buf []byte
+	exists := false
+
+	if err = checkDBNames(c, srcName, dstName); err != nil {
+		goto end
+	}
+
+	if err = scanDBKeys(c, srcName, func(keys []string) error {
+		for _, k := range keys {
+			c.Send("COPY", k, dstName+strings.TrimPrefix(k, srcName))
+		}
+
+		if err := c.Flush(); err != nil {
+			return err
+		}
+
+		// Receive all replies before returning the first error to keep the connection usable.
+		var firstErr error
+		for _, k := range keys {
+			if _, err := c.Receive(); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("Copy %v error: %v", k, err)
+			}
+		}
+		return firstErr
+	}); err != nil {
+		goto end
+	}
+
+	if entry, exists, err = getCatalogEntry(c, srcName); err != nil {
+		goto end
+	}
+
+	if exists {
+		entry.Name = dstName
+		entry.Created = time.Now().UnixMilli()
+		if buf, err = json.Marshal(entry); err != nil {
+			goto end
+		}
+
+		if _, err = c.Do("HSET", CatalogKey, dstName, buf); err != nil {
+			goto end
+		}
+	}
+
+	debugPrintf("CopyDB() ok. %v -> %v\n", srcName, dstName)
+
+end:
+	if err != nil {
+		debugPrintf("CopyDB() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// checkDBNames checks the source and destination database names for RenameDB() and CopyDB().
+func checkDBNames(c redis.Conn, srcName, dstName string) (err error) {
+	exists := false
+
+	if len(srcName) == 0 || len(dstName) == 0 {
+		return fmt.Errorf("Empty db name.")
+	}
+
+	if srcName == dstName {
+		return fmt.Errorf("Same db name: %v.", srcName)
+	}
+
+	if strings.HasPrefix(dstName, srcName+"/") || strings.HasPrefix(srcName, dstName+"/") {
+		return fmt.Errorf("Nested db names: %v, %v.", srcName, dstName)
+	}
+
+	if exists, err = dbExists(c, srcName); err != nil {
+		return err
+	}
+
+	if !exists {
+		return fmt.Errorf("Db %v does not exist.", srcName)
+	}
+
+	if exists, err = dbExists(c, dstName); err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("Db %v already exists.", dstName)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/northbright/simpledb"
+)
+
+func ExampleListDBs() {
+	var err error
+	var c redis.Conn
+	var db *simpledb.DB
+	infos := []simpledb.DBInfo{}
+
+	log.Printf("\n")
+	log.Printf("--------- ListDBs() Test Begin --------\n")
+
+	if c, err = simpledb.GetRedisConn(":6379", ""); err != nil {
+		goto end
+	}
+	defer c.Close()
+
+	// Open() records the database in the catalog.
+	if db, err = simpledb.Open(":6379", "", "catalog-test"); err != nil {
+		goto end
+	}
+	defer db.Close()
+
+	if _, err = db.Create(`{"name":"Walt","tel":"13900139091"}`); err != nil {
+		goto end
+	}
+
+	if infos, err = simpledb.ListDBs(c); err != nil {
+		goto end
+	}
+
+	for _, info := range infos {
+		log.Printf("name: %v, created at: %v, settings: %v\n", info.Name, info.CreatedAt, info.Settings)
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- ListDBs() Test End --------\n")
+	// Output:
+}
+
+func ExampleCopyDB() {
+	var err error
+	var c redis.Conn
+
+	log.Printf("\n")
+	log.Printf("--------- CopyDB() Test Begin --------\n")
+
+	if c, err = simpledb.GetRedisConn(":6379", ""); err != nil {
+		goto end
+	}
+	defer c.Close()
+
+	if err = simpledb.CopyDB(c, "catalog-test", "catalog-test-copy"); err != nil {
+		goto end
+	}
+
+	if err = simpledb.RenameDB(c, "catalog-test-copy", "catalog-test-renamed"); err != nil {
+		goto end
+	}
+
+	if err = simpledb.DropDB(c, "catalog-test-renamed"); err != nil {
+		goto end
+	}
+
+	if err = simpledb.DropDB(c, "catalog-test"); err != nil {
+		goto end
+	}
+
+	log.Printf("OK.\n")
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- CopyDB() Test End --------\n")
+	// Output:
+}
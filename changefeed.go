@@ -0,0 +1,404 @@
+package simpledb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// SubscribeBlockMilliseconds is the max time in milliseconds a subscription blocks on XREAD / XREADGROUP.
+	// Cancellation of the context is checked after each read.
+	SubscribeBlockMilliseconds = 1000
+	// SubscribeReadCount is the max number of changes read from the stream at a time.
+	SubscribeReadCount = 128
+)
+
+// ChangeOp is the operation of a record change.
+type ChangeOp string
+
+const (
+	// ChangeCreate means a record is created.
+	ChangeCreate ChangeOp = "create"
+	// ChangeUpdate means the data of a record is replaced.
+	ChangeUpdate ChangeOp = "update"
+	// ChangeDelete means a record is deleted.
+	ChangeDelete ChangeOp = "delete"
+)
+
+// Change is a record change.
+type Change struct {
+	// StreamID is the ID of the change in the change feed stream.
+	StreamID string
+	// Op is the operation.
+	Op ChangeOp
+	// ID is record ID.
+	ID string
+	// OldData is the record data before the change. It's empty for ChangeCreate.
+	OldData string
+	// NewData is the record data after the change. It's empty for ChangeDelete.
+	NewData string
+}
+
+// SetChangeFeed sets change feed mode.
+// In change feed mode, every create, update and delete appends a change to a Redis stream of the DB
+// in the same transaction. Changes can be consumed by Subscribe() or SubscribeGroup().
+//
+//	Params:
+//	    maxLen: approximate max length of the stream(XADD MAXLEN ~). Change feed is disabled if it's 0.
+func (db *DB) SetChangeFeed(maxLen int64) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	db.changeFeedMaxLen = maxLen
+}
+
+// genChangeFeedKey generates the key of the change feed stream.
+func (db *DB) genChangeFeedKey() string {
+	return fmt.Sprintf("%v/changes", db.name)
+}
+
+// encryptChangeData encrypts the record data of a change for encrypted databases. Empty data is not encrypted.
+func (db *DB) encryptChangeData(data string) (v string, err error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	return db.encryptData(data)
+}
+
+// decryptChange decrypts the record data of the change. Plain data is returned as it is.
+func (db *DB) decryptChange(change *Change) (err error) {
+	if change.OldData, err = db.decryptData(change.OldData); err != nil {
+		return err
+	}
+
+	if change.NewData, err = db.decryptData(change.NewData); err != nil {
+		return err
+	}
+	return nil
+}
+
+// queueChange queues the commands to append a change to the change feed and publish it to watchers in the transaction.
+// It's a no-op if both change feed and watch notify mode are disabled.
+// Record data is encrypted for encrypted databases so that no plain data is stored in Redis.
+func (db *DB) queueChange(t *tx, op ChangeOp, id uint64, oldData, newData string) (err error) {
+	if db.changeFeedMaxLen == 0 && !db.watchNotify {
+		return nil
+	}
+
+	if oldData, err = db.encryptChangeData(oldData); err != nil {
+		return err
+	}
+
+	if newData, err = db.encryptChangeData(newData); err != nil {
+		return err
+	}
+
+	if db.changeFeedMaxLen > 0 {
+		t.send("XADD", db.genChangeFeedKey(), "MAXLEN", "~", db.changeFeedMaxLen, "*",
+			"op", string(op), "id", id, "old", oldData, "new", newData)
+	}
+	db.queuePublish(t, op, id, oldData, newData)
+	return nil
+}
+
+// parseStreamReply parses the reply of XREAD / XREADGROUP into changes.
+// Reply format: [[key, [[stream id, [field, value, ...]], ...]], ...]
+func parseStreamReply(reply interface{}) (changes []Change, err error) {
+	var streams, entries, entry []interface{}
+	var fields map[string]string
+	var streamID string
+
+	if reply == nil {
+		return []Change{}, nil
+	}
+
+	if streams, err = redis.Values(reply, nil); err != nil {
+		return nil, err
+	}
+
+	for _, stream := range streams {
+		if entries, err = redis.Values(stream, nil); err != nil {
+			return nil, err
+		}
+
+		if len(entries) != 2 {
+			return nil, fmt.Errorf("Stream reply error.")
+		}
+
+		if entries, err = redis.Values(entries[1], nil); err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if entry, err = redis.Values(e, nil); err != nil {
+				return nil, err
+			}
+
+			if len(entry) != 2 {
+				return nil, fmt.Errorf("Stream entry error.")
+			}
+
+			if streamID, err = redis.String(entry[0], nil); err != nil {
+				return nil, err
+			}
+
+			// Entry of a pending change which is already trimmed from the stream has nil fields.
+			// It's delivered with StreamID only so that it can be acknowledged.
+			if entry[1] == nil {
+				changes = append(changes, Change{StreamID: streamID})
+				continue
+			}
+
+			if fields, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+
+			changes = append(changes, Change{
+				StreamID: streamID,
+				Op:       ChangeOp(fields["op"]),
+				ID:       fields["id"],
+				OldData:  fields["old"],
+				NewData:  fields["new"],
+			})
+		}
+	}
+	return changes, nil
+}
+
+// Subscription receives changes from the change feed.
+type Subscription struct {
+	// C delivers the changes. It's closed when the context is canceled or an error occurs.
+	C <-chan Change
+	c chan Change
+	// db is used to read the stream with a dedicated Redis connection.
+	db *DB
+	// group and consumer are consumer group name and consumer name. They're empty if consumer group is not used.
+	group    string
+	consumer string
+	// ackConn is the Redis connection for XACK.
+	ackConn redis.Conn
+	mu      sync.Mutex
+	err     error
+}
+
+// Err returns the error which ends the subscription. It should be called after C is closed.
+// It returns nil if the subscription is ended by canceling the context.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Ack acknowledges the changes processed by the consumer(XACK).
+// It's only available for the subscription created by SubscribeGroup().
+func (s *Subscription) Ack(streamIDs ...string) (err error) {
+	args := []interface{}{s.db.genChangeFeedKey(), s.group}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.group) == 0 {
+		err = fmt.Errorf("Ack() is only available for consumer group.")
+		goto end
+	}
+
+	if len(streamIDs) == 0 {
+		goto end
+	}
+
+	if s.ackConn == nil {
+		if s.ackConn, err = GetRedisConn(s.db.redisAddr, s.db.redisPassword); err != nil {
+			goto end
+		}
+	}
+
+	for _, id := range streamIDs {
+		args = append(args, id)
+	}
+
+	if _, err = s.ackConn.Do("XACK", args...); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Ack() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// run reads the stream and sends changes to the channel until the context is canceled or an error occurs.
+func (s *Subscription) run(ctx context.Context, lastID string) {
+	var reply interface{}
+	var changes []Change
+	var err error
+	k := s.db.genChangeFeedKey()
+	// Read pending changes of the consumer first to redeliver unacknowledged changes.
+	pending := true
+
+	defer func() {
+		s.mu.Lock()
+		s.err = err
+		if s.ackConn != nil {
+			s.ackConn.Close()
+			s.ackConn = nil
+		}
+		s.mu.Unlock()
+
+		s.db.Close()
+		close(s.c)
+	}()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if len(s.group) == 0 {
+			reply, err = s.db.c.Do("XREAD", "COUNT", SubscribeReadCount, "BLOCK", SubscribeBlockMilliseconds, "STREAMS", k, lastID)
+		} else if pending {
+			reply, err = s.db.c.Do("XREADGROUP", "GROUP", s.group, s.consumer, "COUNT", SubscribeReadCount, "STREAMS", k, lastID)
+		} else {
+			reply, err = s.db.c.Do("XREADGROUP", "GROUP", s.group, s.consumer, "COUNT", SubscribeReadCount, "BLOCK", SubscribeBlockMilliseconds, "STREAMS", k, ">")
+		}
+
+		if err != nil {
+			debugPrintf("Subscription.run() error: %v\n", err)
+			return
+		}
+
+		if changes, err = parseStreamReply(reply); err != nil {
+			debugPrintf("Subscription.run() error: %v\n", err)
+			return
+		}
+
+		if pending && len(changes) == 0 {
+			pending = false
+		}
+
+		for i := range changes {
+			if err = s.db.decryptChange(&changes[i]); err != nil {
+				debugPrintf("Subscription.run() error: %v\n", err)
+				return
+			}
+		}
+
+		for _, change := range changes {
+			lastID = change.StreamID
+			select {
+			case s.c <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// newSubscription creates a subscription with a dedicated Redis connection.
+func (db *DB) newSubscription(group, consumer string) (s *Subscription, err error) {
+	c := make(chan Change)
+	s = &Subscription{C: c, c: c, group: group, consumer: consumer}
+
+	if s.db, err = db.clone(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// lastStreamID returns the ID of the last change in the change feed. It returns "0-0" if the stream is empty.
+func (db *DB) lastStreamID() (id string, err error) {
+	var entries []interface{}
+	var entry []interface{}
+
+	if entries, err = redis.Values(db.c.Do("XREVRANGE", db.genChangeFeedKey(), "+", "-", "COUNT", 1)); err != nil {
+		return "", err
+	}
+
+	if len(entries) == 0 {
+		return "0-0", nil
+	}
+
+	if entry, err = redis.Values(entries[0], nil); err != nil {
+		return "", err
+	}
+
+	if len(entry) != 2 {
+		return "", fmt.Errorf("Stream entry error.")
+	}
+
+	return redis.String(entry[0], nil)
+}
+
+// Subscribe subscribes the change feed.
+//
+//	Params:
+//	    ctx: the subscription ends when ctx is canceled.
+//	    fromID: changes after fromID are delivered. Use "0" to read from the beginning,
+//	            "$" to read new changes only, or the StreamID of the last processed change to resume.
+//	Returns:
+//	    s: subscription which delivers changes in its channel.
+func (db *DB) Subscribe(ctx context.Context, fromID string) (s *Subscription, err error) {
+	if fromID == "$" {
+		if fromID, err = db.lastStreamID(); err != nil {
+			goto end
+		}
+	}
+
+	if s, err = db.newSubscription("", ""); err != nil {
+		goto end
+	}
+
+	go s.run(ctx, fromID)
+
+end:
+	if err != nil {
+		debugPrintf("Subscribe() error: %v\n", err)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// SubscribeGroup subscribes the change feed as a consumer of a consumer group.
+// Each change is delivered to one consumer of the group. Changes should be acknowledged by Subscription.Ack() after processed.
+// Unacknowledged changes of the consumer are delivered again when it subscribes next time.
+//
+//	Params:
+//	    ctx: the subscription ends when ctx is canceled.
+//	    group: consumer group name. The group is created if it does not exist.
+//	    consumer: consumer name.
+//	    fromID: start position of the group when it's created. Use "0" to read from the beginning or "$" to read new changes only.
+func (db *DB) SubscribeGroup(ctx context.Context, group, consumer, fromID string) (s *Subscription, err error) {
+	if len(group) == 0 || len(consumer) == 0 {
+		err = fmt.Errorf("Empty group or consumer name.")
+		goto end
+	}
+
+	if _, err = db.c.Do("XGROUP", "CREATE", db.genChangeFeedKey(), group, fromID, "MKSTREAM"); err != nil {
+		// Ignore the error if the group already exists.
+		if !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			goto end
+		}
+		err = nil
+	}
+
+	if s, err = db.newSubscription(group, consumer); err != nil {
+		goto end
+	}
+
+	go s.run(ctx, "0")
+
+end:
+	if err != nil {
+		debugPrintf("SubscribeGroup() error: %v\n", err)
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,108 @@
+package simpledb_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Subscribe() {
+	var err error
+	var db *simpledb.DB
+	var s *simpledb.Subscription
+	id := ""
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	log.Printf("\n")
+	log.Printf("--------- Subscribe() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "changefeed-test")
+	defer db.Close()
+
+	db.SetChangeFeed(10000)
+
+	// Subscribe new changes only.
+	if s, err = db.Subscribe(ctx, "$"); err != nil {
+		goto end
+	}
+
+	if id, err = db.Create(`{"name":"Rose","tel":"13900139071"}`); err != nil {
+		goto end
+	}
+
+	if err = db.Update(simpledb.Record{ID: id, Data: `{"name":"Rose","tel":"18900189071"}`}); err != nil {
+		goto end
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	for i := 0; i < 3; i++ {
+		change, ok := <-s.C
+		if !ok {
+			break
+		}
+		log.Printf("stream id: %v, op: %v, id: %v, old: %v, new: %v\n", change.StreamID, change.Op, change.ID, change.OldData, change.NewData)
+	}
+	cancel()
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Subscribe() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_SubscribeGroup() {
+	var err error
+	var db *simpledb.DB
+	var s *simpledb.Subscription
+	id := ""
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	log.Printf("\n")
+	log.Printf("--------- SubscribeGroup() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "changefeed-test")
+	defer db.Close()
+
+	db.SetChangeFeed(10000)
+
+	if s, err = db.SubscribeGroup(ctx, "indexer", "indexer-1", "$"); err != nil {
+		goto end
+	}
+
+	if id, err = db.Create(`{"name":"Sam","tel":"13900139072"}`); err != nil {
+		goto end
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	for i := 0; i < 2; i++ {
+		change, ok := <-s.C
+		if !ok {
+			break
+		}
+		log.Printf("op: %v, id: %v\n", change.Op, change.ID)
+
+		// Acknowledge the change after it's processed.
+		if err = s.Ack(change.StreamID); err != nil {
+			goto end
+		}
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SubscribeGroup() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,207 @@
+package simpledb
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// BucketStats is the fill statistics of record buckets.
+type BucketStats struct {
+	// MaxBucketID is the max record bucket id. Buckets from 1 to MaxBucketID are iterated by Count() and Info().
+	MaxBucketID uint64
+	// BucketCapacity is the max number of records of a bucket("hash-max-ziplist-entries").
+	BucketCapacity uint64
+	// RecordNum is the number of records.
+	RecordNum uint64
+	// NonEmptyBucketNum is the number of buckets which contain records.
+	NonEmptyBucketNum uint64
+	// EmptyBucketNum is the number of empty buckets from 1 to MaxBucketID.
+	EmptyBucketNum uint64
+	// SparseBucketNum is the number of non-empty buckets which are less than half full.
+	// Compact() does not change sparse buckets because records are never moved.
+	SparseBucketNum uint64
+	// TrailingEmptyBucketNum is the number of empty buckets after the last non-empty bucket.
+	// Compact() shrinks max bucket id by this number at most. Buckets which contain trashed records are kept.
+	TrailingEmptyBucketNum uint64
+	// FillRatio is RecordNum / (NonEmptyBucketNum * BucketCapacity). It's 0 if there's no record.
+	FillRatio float64
+}
+
+// CompactResult is the result of Compact().
+type CompactResult struct {
+	// Stats is the bucket statistics before compaction.
+	Stats BucketStats
+	// OldMaxBucketID is the max bucket id before compaction.
+	OldMaxBucketID uint64
+	// NewMaxBucketID is the max bucket id after compaction.
+	NewMaxBucketID uint64
+}
+
+// getBucketLens gets the number of records of bucket 1 to maxBucketID in pipelines.
+// lens[i] is the number of records of bucket i + 1.
+func (db *DB) getBucketLens(maxBucketID uint64) (lens []uint64, err error) {
+	var n uint64
+
+	for start := uint64(1); start <= maxBucketID; start += KeyBatchSize {
+		end := start + KeyBatchSize - 1
+		if end > maxBucketID {
+			end = maxBucketID
+		}
+
+		for i := start; i <= end; i++ {
+			db.c.Send("HLEN", fmt.Sprintf("%v/bucket/%v", db.name, i))
+		}
+
+		if err = db.c.Flush(); err != nil {
+			return nil, err
+		}
+
+		// Receive all replies before returning the first error to keep the connection usable.
+		var firstErr error
+		for i := start; i <= end; i++ {
+			if n, err = redis.Uint64(db.c.Receive()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			lens = append(lens, n)
+		}
+
+		if firstErr != nil {
+			return nil, firstErr
+		}
+	}
+	return lens, nil
+}
+
+// computeBucketStats computes the bucket statistics by the number of records of each bucket.
+func (db *DB) computeBucketStats(lens []uint64) (stats BucketStats) {
+	stats.MaxBucketID = uint64(len(lens))
+	stats.BucketCapacity = db.redisHashMaxZiplistEntries
+
+	for _, n := range lens {
+		if n == 0 {
+			stats.EmptyBucketNum++
+			stats.TrailingEmptyBucketNum++
+			continue
+		}
+
+		stats.RecordNum += n
+		stats.NonEmptyBucketNum++
+		stats.TrailingEmptyBucketNum = 0
+
+		if n*2 < stats.BucketCapacity {
+			stats.SparseBucketNum++
+		}
+	}
+
+	if stats.NonEmptyBucketNum > 0 {
+		stats.FillRatio = float64(stats.RecordNum) / float64(stats.NonEmptyBucketNum*stats.BucketCapacity)
+	}
+	return stats
+}
+
+// GetBucketStats returns the fill statistics of record buckets.
+// It can be used to decide when Compact() is worthwhile. Ex: TrailingEmptyBucketNum is large.
+func (db *DB) GetBucketStats() (stats BucketStats, err error) {
+	var maxBucketID uint64
+	var lens []uint64
+
+	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
+		goto end
+	}
+
+	if lens, err = db.getBucketLens(maxBucketID); err != nil {
+		goto end
+	}
+
+	stats = db.computeBucketStats(lens)
+
+end:
+	if err != nil {
+		debugPrintf("GetBucketStats() error: %v\n", err)
+		return BucketStats{}, err
+	}
+
+	return stats, nil
+}
+
+// shrinkMaxBucketID sets max bucket id to the id of the last non-empty bucket(1 if all buckets are empty).
+// A bucket is empty only if both the record bucket and the trash bucket are empty,
+// so that trashed records are still walked by RotateKeys() and restored into visible buckets.
+// Empty buckets are watched so that the transaction is aborted if a record is created or trashed in them concurrently.
+func (db *DB) shrinkMaxBucketID() (oldMaxBucketID, newMaxBucketID uint64, err error) {
+	_, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		var n, trashed uint64
+		var err error
+
+		if oldMaxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+
+		for newMaxBucketID = oldMaxBucketID; newMaxBucketID > 1; newMaxBucketID-- {
+			recordHashKey := fmt.Sprintf("%v/bucket/%v", db.name, newMaxBucketID)
+			trashHashKey := fmt.Sprintf("%v/trash/bucket/%v", db.name, newMaxBucketID)
+			if err = db.watch(recordHashKey, trashHashKey); err != nil {
+				return err
+			}
+
+			if n, err = redis.Uint64(db.c.Do("HLEN", recordHashKey)); err != nil {
+				return err
+			}
+
+			if trashed, err = redis.Uint64(db.c.Do("HLEN", trashHashKey)); err != nil {
+				return err
+			}
+
+			if n > 0 || trashed > 0 {
+				break
+			}
+		}
+
+		if newMaxBucketID < oldMaxBucketID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxBucketID, newMaxBucketID)
+		}
+		return nil
+	})
+	return oldMaxBucketID, newMaxBucketID, err
+}
+
+// Compact shrinks max bucket id to the last bucket which contains records or trashed records after mass deletions.
+//
+//	Returns:
+//	    result: bucket statistics before compaction, old and new max bucket id.
+//	Comments:
+//	    Redis deletes record buckets(hashes) and version buckets automatically when they become empty,
+//	    so the memory of empty buckets is already reclaimed. Compact() only makes Count(), Info()
+//	    and other functions which iterate buckets skip the trailing empty buckets(see BucketStats.TrailingEmptyBucketNum).
+//	    Records are never moved because bucket ids are computed by record ids.
+//	    Empty buckets before the last non-empty bucket and sparse buckets are not changed.
+//	    It's safe to call Compact() while other clients write.
+func (db *DB) Compact() (result CompactResult, err error) {
+	var maxBucketID uint64
+	var lens []uint64
+
+	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
+		goto end
+	}
+
+	if lens, err = db.getBucketLens(maxBucketID); err != nil {
+		goto end
+	}
+
+	result.Stats = db.computeBucketStats(lens)
+
+	if result.OldMaxBucketID, result.NewMaxBucketID, err = db.shrinkMaxBucketID(); err != nil {
+		goto end
+	}
+
+	debugPrintf("Compact() ok. result: %+v\n", result)
+
+end:
+	if err != nil {
+		debugPrintf("Compact() error: %v\n", err)
+		return CompactResult{}, err
+	}
+
+	return result, nil
+}
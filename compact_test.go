@@ -0,0 +1,53 @@
+package simpledb_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Compact() {
+	var err error
+	var db *simpledb.DB
+	var ids []string
+	var stats simpledb.BucketStats
+	var result simpledb.CompactResult
+	dataArr := []string{}
+
+	log.Printf("\n")
+	log.Printf("--------- Compact() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "compact-test")
+	defer db.Close()
+
+	for i := 0; i < 2000; i++ {
+		dataArr = append(dataArr, fmt.Sprintf(`{"name":"user%v"}`, i))
+	}
+
+	if ids, err = db.BatchCreate(dataArr); err != nil {
+		goto end
+	}
+
+	// Delete most records.
+	if err = db.BatchDelete(ids[10:]); err != nil {
+		goto end
+	}
+
+	if stats, err = db.GetBucketStats(); err != nil {
+		goto end
+	}
+	log.Printf("stats: %+v\n", stats)
+
+	if result, err = db.Compact(); err != nil {
+		goto end
+	}
+	log.Printf("max bucket id: %v -> %v\n", result.OldMaxBucketID, result.NewMaxBucketID)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Compact() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,275 @@
+package simpledb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// CodecFlate compresses record data by DEFLATE(compress/flate). It supports dictionary.
+	CodecFlate = "flate"
+	// CodecGzip compresses record data by gzip(compress/gzip).
+	CodecGzip = "gzip"
+)
+
+// Header of encoded values in record buckets.
+// Encoded values start with a NUL byte followed by the codec byte. Other values are raw record data.
+// Values are compressed first and then encrypted(see encrypt.go).
+const (
+	encodedMark  byte = 0x00
+	encodedRaw   byte = 'r' // raw data which starts with a NUL byte.
+	encodedFlate byte = 'f'
+	encodedGzip  byte = 'g'
+	encodedDict  byte = 'd' // flate with dictionary. Followed by 4 bytes CRC32 of the dictionary.
+)
+
+// Compression is the compression setting of record data.
+type Compression struct {
+	// Codec is CodecFlate or CodecGzip.
+	Codec string
+	// Level is the compression level from flate.BestSpeed(1) to flate.BestCompression(9).
+	// flate.BestCompression is used if it's 0 because record data are small and lower levels often store small data uncompressed.
+	Level int
+	// Dict is the preset dictionary of CodecFlate. It improves the ratio of small JSON data.
+	// Ex: a typical record or the common field names. All clients should use the same dictionary to read the data.
+	Dict []byte
+	// MinSize is the min length of record data to compress. Shorter data are stored uncompressed.
+	MinSize int
+}
+
+// SetCompression sets the compression of record data stored in record buckets.
+// Compression is disabled if c is nil. Data are stored uncompressed if compression does not reduce the size.
+// Reading compressed records does not depend on the setting except the dictionary.
+// Index buckets always store uncompressed data for search.
+func (db *DB) SetCompression(c *Compression) (err error) {
+	var level int
+	var dictCRC uint32
+
+	if c == nil {
+		db.compression = nil
+		return nil
+	}
+
+	level = c.Level
+	if level == 0 {
+		level = flate.BestCompression
+	}
+
+	switch c.Codec {
+	case CodecFlate:
+		_, err = flate.NewWriterDict(io.Discard, level, c.Dict)
+	case CodecGzip:
+		if len(c.Dict) != 0 {
+			err = fmt.Errorf("Dictionary is not supported by gzip.")
+		} else {
+			_, err = gzip.NewWriterLevel(io.Discard, level)
+		}
+	default:
+		err = fmt.Errorf("Unsupported codec: %v.", c.Codec)
+	}
+
+	if err != nil {
+		debugPrintf("SetCompression() error: %v\n", err)
+		return err
+	}
+
+	if len(c.Dict) != 0 {
+		dictCRC = crc32.ChecksumIEEE(c.Dict)
+	}
+
+	db.compression = &compression{Compression: *c, level: level, dictCRC: dictCRC}
+	return nil
+}
+
+// compression is the compression setting with precomputed values.
+type compression struct {
+	Compression
+	level   int
+	dictCRC uint32
+}
+
+// compressData compresses the record data if compression is enabled.
+func (db *DB) compressData(data string) string {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	c := db.compression
+
+	if c == nil || len(data) < c.MinSize {
+		goto raw
+	}
+
+	buf.WriteByte(encodedMark)
+
+	switch {
+	case c.Codec == CodecGzip:
+		buf.WriteByte(encodedGzip)
+		w, err = gzip.NewWriterLevel(&buf, c.level)
+	case len(c.Dict) != 0:
+		buf.WriteByte(encodedDict)
+		binary.Write(&buf, binary.BigEndian, c.dictCRC)
+		w, err = flate.NewWriterDict(&buf, c.level, c.Dict)
+	default:
+		buf.WriteByte(encodedFlate)
+		w, err = flate.NewWriter(&buf, c.level)
+	}
+
+	if err != nil {
+		goto raw
+	}
+
+	if _, err = io.WriteString(w, data); err != nil {
+		goto raw
+	}
+
+	if err = w.Close(); err != nil {
+		goto raw
+	}
+
+	if buf.Len() < len(data) {
+		return buf.String()
+	}
+
+raw:
+	if err != nil {
+		debugPrintf("compressData() error: %v, store raw data\n", err)
+	}
+
+	// Mark raw data which starts with a NUL byte to distinguish it from encoded values.
+	if len(data) != 0 && data[0] == encodedMark {
+		return string([]byte{encodedMark, encodedRaw}) + data
+	}
+	return data
+}
+
+// decompressData decompresses the value returned by compressData() to record data.
+func (db *DB) decompressData(v string) (data string, err error) {
+	var r io.Reader
+	var buf []byte
+	var dictCRC uint32
+
+	if len(v) == 0 || v[0] != encodedMark {
+		return v, nil
+	}
+
+	if len(v) < 2 {
+		return "", fmt.Errorf("Invalid encoded data.")
+	}
+
+	payload := bytes.NewReader([]byte(v[2:]))
+
+	switch v[1] {
+	case encodedRaw:
+		return v[2:], nil
+	case encodedFlate:
+		r = flate.NewReader(payload)
+	case encodedGzip:
+		if r, err = gzip.NewReader(payload); err != nil {
+			return "", err
+		}
+	case encodedDict:
+		if err = binary.Read(payload, binary.BigEndian, &dictCRC); err != nil {
+			return "", err
+		}
+
+		if db.compression == nil || len(db.compression.Dict) == 0 || db.compression.dictCRC != dictCRC {
+			return "", fmt.Errorf("Compression dictionary mismatch. CRC32 of the dictionary: %v.", dictCRC)
+		}
+		r = flate.NewReaderDict(payload, db.compression.Dict)
+	default:
+		return "", fmt.Errorf("Unknown codec of encoded data: %q.", v[1])
+	}
+
+	if buf, err = io.ReadAll(r); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// isCompressedData checks if the value returned by compressData() is compressed.
+func isCompressedData(v string) bool {
+	return len(v) >= 2 && v[0] == encodedMark && v[1] != encodedRaw
+}
+
+// CompressionStats is the compression statistics of records.
+type CompressionStats struct {
+	// RecordNum is the number of records.
+	RecordNum uint64
+	// CompressedRecordNum is the number of compressed records.
+	CompressedRecordNum uint64
+	// DataSize is the total size of record data.
+	DataSize uint64
+	// StoredSize is the total size of values stored in record buckets.
+	StoredSize uint64
+	// Ratio is StoredSize / DataSize. It's 0 if there's no record.
+	Ratio float64
+}
+
+// addCompressionStats decodes the values of a record bucket and adds them to the stats.
+func (db *DB) addCompressionStats(stats *CompressionStats, values []string) (err error) {
+	var inner, data string
+
+	for _, v := range values {
+		if v, err = db.loadOverflow(v); err != nil {
+			return err
+		}
+
+		if inner, err = db.decryptData(v); err != nil {
+			return err
+		}
+
+		if data, err = db.decompressData(inner); err != nil {
+			return err
+		}
+
+		stats.RecordNum++
+		stats.DataSize += uint64(len(data))
+		stats.StoredSize += uint64(len(v))
+
+		if isCompressedData(inner) {
+			stats.CompressedRecordNum++
+		}
+	}
+
+	if stats.DataSize > 0 {
+		stats.Ratio = float64(stats.StoredSize) / float64(stats.DataSize)
+	}
+	return nil
+}
+
+// GetCompressionStats scans all record buckets and returns the compression statistics.
+// It reads and decodes every record. Info() computes the same stats in its pass over the record buckets.
+// The same encryption keys(see SetEncryption()) and compression dictionary as the writers are needed.
+func (db *DB) GetCompressionStats() (stats CompressionStats, err error) {
+	var maxBucketID uint64
+	var values []string
+
+	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
+		goto end
+	}
+
+	for i := uint64(1); i <= maxBucketID; i++ {
+		if values, err = redis.Strings(db.c.Do("HVALS", fmt.Sprintf("%v/bucket/%v", db.name, i))); err != nil {
+			goto end
+		}
+
+		if err = db.addCompressionStats(&stats, values); err != nil {
+			goto end
+		}
+	}
+
+end:
+	if err != nil {
+		debugPrintf("GetCompressionStats() error: %v\n", err)
+		return CompressionStats{}, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,51 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetCompression() {
+	var err error
+	var db *simpledb.DB
+	var id string
+	var r simpledb.Record
+	var stats simpledb.CompressionStats
+
+	log.Printf("\n")
+	log.Printf("--------- SetCompression() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "compress-test")
+	defer db.Close()
+
+	// Use a typical record as the dictionary to compress small JSON data.
+	if err = db.SetCompression(&simpledb.Compression{
+		Codec: simpledb.CodecFlate,
+		Dict:  []byte(`{"name":"","tel":"","address":"Room , Building , Road, District, City"}`),
+	}); err != nil {
+		goto end
+	}
+
+	if id, err = db.Create(`{"name":"Linda","tel":"13500135501","address":"Room 302, Building 7, Garden Road, East District, Some City"}`); err != nil {
+		goto end
+	}
+
+	// Get decompresses the data transparently.
+	if r, err = db.Get(id); err != nil {
+		goto end
+	}
+	log.Printf("record: %v\n", r)
+
+	if stats, err = db.GetCompressionStats(); err != nil {
+		goto end
+	}
+	log.Printf("compression stats: %+v\n", stats)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetCompression() Test End --------\n")
+	// Output:
+}
@@ -1,6 +1,7 @@
 package simpledb
 
 import (
+	"context"
 	"fmt"
 	"hash/crc32"
 	"regexp"
@@ -31,10 +32,48 @@ type DB struct {
 	name string
 	// Redis "hash-max-ziplist-entries" value. It'll be initialize only once in Open().
 	redisHashMaxZiplistEntries uint64
+	// Redis "hash-max-ziplist-value" value. It's read from Redis config in Open().
+	redisHashMaxZiplistValue uint64
+	// Policy of record data longer than "hash-max-ziplist-value".
+	oversizePolicy OversizePolicy
 	// Estimated index bucket number.
 	estIndexBucketNum uint64
+	// Estimated record bucket number. It's used by hashed bucket mapping.
+	estRecordBucketNum uint64
+	// Hashed bucket mapping. Record IDs are mapped to buckets by hash if it's true(see BucketMappingHashed).
+	hashedBuckets bool
+	// ID generator of new records. SequentialIDGenerator is used if it's nil.
+	idGenerator IDGenerator
+	// Kind of the ID generator stored in the meta data. It's read in Open() and set by SetIDGenerator().
+	storedIDGenerator string
+	// Compression of record data. Compression is disabled if it's nil.
+	compression *compression
+	// Encrypted database. It's read from the meta data.
+	encrypted bool
+	// Encryption of record data. It's set by SetEncryption().
+	encryption *Encryption
 	// Index hash key scan pattern. It's used to scan index entries in Redis.
 	indexHashKeyScanPattern string
+	// Soft-delete mode. Deleted records are moved to the trash if it's true.
+	softDelete bool
+	// Max revisions kept in the history of each record. History mode is disabled if it's 0.
+	maxRevisions int
+	// Approximate max length of the change feed stream. Change feed is disabled if it's 0.
+	changeFeedMaxLen int64
+	// Watch notify mode. Changes are published to the watch channel if it's true.
+	watchNotify bool
+	// Validator of record data. Validation is disabled if it's nil.
+	validator Validator
+	// Hooks called around operations.
+	hooks []Hook
+	// Context passed to hooks. It's set by WithContext().
+	ctx context.Context
+	// Text search mode. The inverted index is maintained if it's true.
+	textIndex bool
+	// Indexes of JSON fields. They're added by AddFieldIndex() and read from the meta data in Open().
+	fieldIndexes []fieldIndex
+	// Functions to stop the reapers started by StartReaper(). They're called by Close().
+	reaperStops []func()
 }
 
 // Record contains record ID and data string.
@@ -45,16 +84,10 @@ type Record struct {
 	Data string
 }
 
-// genRedisHashMaxZiplistEntriesKey Generates the "hash-max-ziplist-entries" key for DB.
-func (db *DB) genRedisHashMaxZiplistEntriesKey() (redisHashMaxZiplistEntriesKey string) {
-	return fmt.Sprintf("%v/redis-hash-max-ziplist-entries", db.name)
-}
-
 // Open returns an DB instance by given database name.
 func Open(redisAddr, redisPassword, name string) (db *DB, err error) {
 	db = &DB{redisAddr: redisAddr, redisPassword: redisPassword, name: name}
-	exists := false
-	k := db.genRedisHashMaxZiplistEntriesKey()
+	mapping := ""
 
 	if db.c, err = GetRedisConn(redisAddr, redisPassword); err != nil {
 		goto end
@@ -65,29 +98,44 @@ func Open(redisAddr, redisPassword, name string) (db *DB, err error) {
 		goto end
 	}
 
-	if exists, err = redis.Bool(db.c.Do("EXISTS", k)); err != nil {
+	// Create the meta data or upgrade the key layout of an existing database.
+	// db.redisHashMaxZiplistEntries is set only once at first time and read from the meta data.
+	if err = db.upgradeMeta(); err != nil {
 		goto end
 	}
 
-	// Set db.redisHashMaxZiplistEntries only once at first time.
-	if !exists {
-		if db.redisHashMaxZiplistEntries, err = GetRedisHashMaxZiplistEntries(db.c); err != nil {
-			goto end
-		}
-
-		if _, err = db.c.Do("SET", k, db.redisHashMaxZiplistEntries); err != nil {
-			goto end
-		}
-	} else {
-		if db.redisHashMaxZiplistEntries, err = redis.Uint64(db.c.Do("GET", k)); err != nil {
-			goto end
-		}
+	if db.redisHashMaxZiplistValue, err = GetRedisHashMaxZiplistValue(db.c); err != nil {
+		goto end
 	}
 
 	// Initialize estimated index bucket number.
 	db.estIndexBucketNum = EstimatedMaxRecordNum / uint64(float64(db.redisHashMaxZiplistEntries)*0.9)
+	// Initialize estimated record bucket number for hashed bucket mapping.
+	db.estRecordBucketNum = db.estIndexBucketNum
+
+	if mapping, err = db.getBucketMapping(); err != nil {
+		goto end
+	}
+	db.hashedBuckets = mapping == BucketMappingHashed
+
+	if db.storedIDGenerator, err = db.getIDGeneratorKind(); err != nil {
+		goto end
+	}
+
+	if err = db.loadEncrypted(); err != nil {
+		goto end
+	}
+
+	if err = db.loadFieldIndexes(); err != nil {
+		goto end
+	}
 	// Initialize index hash key scan pattern.
-	db.indexHashKeyScanPattern = fmt.Sprintf("%v/idx/bucket/*", db.name)
+	db.indexHashKeyScanPattern = fmt.Sprintf("%v/idx/bucket/*", escapeGlob(db.name))
+
+	// Record the database in the catalog.
+	if err = db.register(); err != nil {
+		goto end
+	}
 end:
 	if err != nil {
 		debugPrintf("Open(%v) error: %v\n", name, err)
@@ -97,40 +145,43 @@ end:
 	return db, nil
 }
 
-// Close closes an DB instance after use.
+// Close closes an DB instance after use. It also stops the reapers started by StartReaper().
 func (db *DB) Close() {
+	for _, stop := range db.reaperStops {
+		stop()
+	}
+	db.reaperStops = nil
+
 	db.c.Close()
 }
 
+// clone returns a copy of the DB instance with a new Redis connection.
+// It's used by background goroutines because a Redis connection can not be shared.
+func (db *DB) clone() (newDB *DB, err error) {
+	newDB = &DB{}
+	*newDB = *db
+	// Reapers belong to the original DB.
+	newDB.reaperStops = nil
+
+	if newDB.c, err = GetRedisConn(db.redisAddr, db.redisPassword); err != nil {
+		debugPrintf("clone() error: %v\n", err)
+		return nil, err
+	}
+
+	return newDB, nil
+}
+
 // computeBucketID returns the record bucket id by given record id.
 func (db *DB) computeBucketID(id uint64) uint64 {
+	if db.hashedBuckets {
+		return db.computeHashedBucketID(id)
+	}
 	return id/db.redisHashMaxZiplistEntries + 1
 }
 
-// genMaxIDKey generates key of max record id.
-func (db *DB) genMaxIDKey() (maxIDKey string) {
-	return fmt.Sprintf("%v/maxid", db.name)
-}
-
 // GetMaxID gets max record id.
 func (db *DB) GetMaxID() (maxID uint64, err error) {
-	k := db.genMaxIDKey()
-	exists := false
-	if exists, err = redis.Bool(db.c.Do("EXISTS", k)); err != nil {
-		goto end
-	}
-
-	if !exists {
-		maxID = 0
-		goto end
-	}
-
-	if maxID, err = redis.Uint64(db.c.Do("GET", k)); err != nil {
-		goto end
-	}
-
-end:
-	if err != nil {
+	if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
 		debugPrintf("GenMaxId() error: %v\n", err)
 		return 0, err
 	}
@@ -138,31 +189,9 @@ end:
 	return maxID, nil
 }
 
-// genMaxBucketIDKey generates the key of max record bucket id.
-func (db *DB) genMaxBucketIDKey() (maxBucketIDKey string) {
-	return fmt.Sprintf("%v/maxbucketid", db.name)
-}
-
 // GetMaxBucketID gets the max record bucket id.
 func (db *DB) GetMaxBucketID() (maxBucketID uint64, err error) {
-	k := db.genMaxBucketIDKey()
-	exists := false
-	if exists, err = redis.Bool(db.c.Do("EXISTS", k)); err != nil {
-		goto end
-	}
-
-	if !exists {
-		if _, err := db.c.Do("SET", k, 1); err != nil {
-			goto end
-		}
-	}
-
-	if maxBucketID, err = redis.Uint64(db.c.Do("GET", k)); err != nil {
-		goto end
-	}
-
-end:
-	if err != nil {
+	if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
 		debugPrintf("GetMaxBucketID() error: %v\n", err)
 		return 1, err
 	}
@@ -178,7 +207,7 @@ func (db *DB) genRecordHashKey(id uint64) string {
 
 // genIndexHashKey generates the index hash(bucket) key by given record data.
 func (db *DB) genIndexHashKey(data string) string {
-	checkSum := crc32.ChecksumIEEE([]byte(data))
+	checkSum := crc32.ChecksumIEEE([]byte(db.genIndexHashField(data)))
 	bucketID := uint64(checkSum) % db.estIndexBucketNum
 	return fmt.Sprintf("%v/idx/bucket/%v", db.name, bucketID)
 }
@@ -187,7 +216,11 @@ func (db *DB) genIndexHashKey(data string) string {
 func (db *DB) Exists(data string) (exists bool, err error) {
 	exists = false
 	indexHashKey := ""
-	indexHashField := data
+	indexHashField := db.genIndexHashField(data)
+
+	if err = db.checkEncryption(); err != nil {
+		goto end
+	}
 
 	indexHashKey = db.genIndexHashKey(data)
 	if exists, err = redis.Bool(db.c.Do("HEXISTS", indexHashKey, indexHashField)); err != nil {
@@ -206,11 +239,13 @@ end:
 // Create creates a new record in database.
 func (db *DB) Create(data string) (id string, err error) {
 	ids := []string{}
-	if ids, err = db.BatchCreate([]string{data}); err != nil {
+	results := []ItemResult{}
+
+	if results, err = db.create(OpCreate, []Record{{Data: data}}, false, 0); err != nil {
 		goto end
 	}
 
-	if len(ids) != 1 {
+	if ids = resultIDs(results); len(ids) != 1 {
 		err = fmt.Errorf("Count of created record != 1.")
 		goto end
 	}
@@ -225,107 +260,20 @@ end:
 }
 
 // BatchCreate creates records in database.
+// All data are created in one transaction. It fails if any data is empty, redundant, invalid or already exists.
+// It returns *ValidationError if any data fails the validator set by SetValidator() or SetSchema().
 func (db *DB) BatchCreate(dataArr []string) (ids []string, err error) {
-	var checkedData = make(map[string]int) // key: data, value: order in dataArr.
-	var nID, maxID, bucketID, maxBucketID, recordHashField uint64
-	var maxBucketIDKey, recordHashKey, indexHashKey, indexHashField, maxIDKey string
-	var ret interface{}
-	err = nil
-	ids = []string{}
-	id := ""
-	ok := false
-	exists := false
-	alreadySendMULTI := false
-
-	// Check data.
-	for i, data := range dataArr {
-		// Check empty data.
-		if len(data) == 0 {
-			err = fmt.Errorf("Empty data.")
-			goto end
-		}
-
-		// Check redundant data in dataArr.
-		if _, ok = checkedData[data]; ok {
-			err = fmt.Errorf("Redundant data found in dataArr: %v", data)
-			goto end
-		}
-		checkedData[data] = i
-
-		// Check if data already exist in db.
-		if exists, err = db.Exists(data); err != nil {
-			goto end
-		}
-
-		if exists {
-			err = fmt.Errorf("Data already exists in db: %v.", data)
-			goto end
-		}
-	}
-
-	// Get max id.
-	if maxID, err = db.GetMaxID(); err != nil {
-		goto end
-	}
-
-	// Get max id key.
-	maxIDKey = db.genMaxIDKey()
-
-	// Get max bucket id key.
-	if maxBucketIDKey = db.genMaxBucketIDKey(); err != nil {
-		goto end
-	}
-
-	// Get max bucket id.
-	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
-		goto end
-	}
-
-	// Prepare piplined transaction.
-	db.c.Send("MULTI")
-	alreadySendMULTI = true
-
-	for i, data := range dataArr {
-		// Increase Id
-		nID = maxID + uint64(i+1)
-		id = strconv.FormatUint(nID, 10)
-		// Insert to result id array
-		ids = append(ids, id)
-
-		// Compute bucket id.
-		bucketID = db.computeBucketID(nID)
+	results := []ItemResult{}
 
-		// Generate hash key for record and index.
-		recordHashKey = db.genRecordHashKey(nID)
-		indexHashKey = db.genIndexHashKey(data)
-
-		// Create record and index.
-		recordHashField = nID
-		indexHashField = data
-
-		db.c.Send("HSET", recordHashKey, recordHashField, data)
-		db.c.Send("HSET", indexHashKey, indexHashField, nID)
-	}
-
-	// Increase max bucket id if need.
-	if bucketID > maxBucketID {
-		db.c.Send("SET", maxBucketIDKey, bucketID)
-	}
-
-	db.c.Send("INCRBY", maxIDKey, len(dataArr))
-
-	// Do piplined transaction.
-	if ret, err = db.c.Do("EXEC"); err != nil {
+	if results, err = db.create(OpBatchCreate, dataRecords(dataArr), false, 0); err != nil {
 		goto end
 	}
+	ids = resultIDs(results)
 
-	debugPrintf("BatchCreate() ok. ret: %v, ids: %v\n", ret, ids)
+	debugPrintf("BatchCreate() ok. ids: %v\n", ids)
 
 end:
 	if err != nil {
-		if alreadySendMULTI {
-			db.c.Do("DISCARD")
-		}
 		debugPrintf("BatchCreate() error: %v\n", err)
 		return []string{}, err
 	}
@@ -363,6 +311,11 @@ end:
 //     Return:
 //         records: record array.
 func (db *DB) BatchGet(ids []string) (records []Record, err error) {
+	return db.get(OpBatchGet, ids)
+}
+
+// batchGet returns multiple record data by given record ids in one transaction.
+func (db *DB) batchGet(ids []string) (records []Record, err error) {
 	var nID uint64
 	recordHashKey := ""
 	alreadySendMULTI := false
@@ -397,16 +350,19 @@ func (db *DB) BatchGet(ids []string) (records []Record, err error) {
 	}
 
 	for i, id := range ids {
+		if dataArr[i], err = db.decodeData(dataArr[i]); err != nil {
+			goto end
+		}
 		records = append(records, Record{ID: id, Data: dataArr[i]})
 	}
 
-	debugPrintf("BatchGet() ok. records: %v\n", records)
+	debugPrintf("batchGet() ok. records: %v\n", records)
 end:
 	if err != nil {
 		if alreadySendMULTI {
 			db.c.Do("DISCARD")
 		}
-		debugPrintf("BatchGet() error: %v\n", err)
+		debugPrintf("batchGet() error: %v\n", err)
 		return []Record{}, err
 	}
 
@@ -417,7 +373,7 @@ end:
 func (db *DB) Get(id string) (r Record, err error) {
 	records := []Record{}
 
-	if records, err = db.BatchGet([]string{id}); err != nil {
+	if records, err = db.get(OpGet, []string{id}); err != nil {
 		goto end
 	}
 end:
@@ -431,91 +387,32 @@ end:
 
 // Update updates the record by given id and new data.
 func (db *DB) Update(record Record) error {
-	return db.BatchUpdate([]Record{record})
+	if _, err := db.update(OpUpdate, []Record{record}, false, nil); err != nil {
+		debugPrintf("Update() error: %v\n", err)
+		return err
+	}
+
+	return nil
 }
 
 // BatchUpdate updates multiple records by given ids and new data.
 //
 //     Params:
 //         records: record array to be updated.
+//
+// All records are checked and updated in one transaction.
+// It fails with *DataExistsError if the new data is already owned by another record,
+// or *ValidationError if the new data fails the validator set by SetValidator() or SetSchema().
+// Records whose new data is the same as the current data are not changed.
 func (db *DB) BatchUpdate(records []Record) (err error) {
-	type updateInfo struct {
-		recordHashKey     string
-		recordHashField   uint64
-		recordHashValue   string
-		oldIndexHashKey   string
-		oldIndexHashField string
-		newIndexHashKey   string
-		newIndexHashField string
-		newIndexHashValue uint64
-	}
-
-	var oldRecord = Record{}
-	var nID uint64
-	var ret interface{}
-	exists := false
-	updateInfos := []updateInfo{}
-	alreadySendMULTI := false
-
-	// Check records.
-	for _, r := range records {
-		if exists, err = db.IDExists(r.ID); err != nil {
-			goto end
-		}
-
-		if !exists {
-			err = fmt.Errorf("Id: %v does not exist.", r.ID)
-			goto end
-		}
-
-		// Check if data already exists in db(may be with another id).
-		if exists, err = db.Exists(r.Data); err != nil {
-			err = fmt.Errorf("Data already exists in db: %v.", r.Data)
-			goto end
-		}
-
-		if oldRecord, err = db.Get(r.ID); err != nil {
-			goto end
-		}
-
-		if nID, err = strconv.ParseUint(r.ID, 10, 64); err != nil {
-			goto end
-		}
-
-		info := updateInfo{
-			recordHashKey:     db.genRecordHashKey(nID),
-			recordHashField:   nID,
-			recordHashValue:   r.Data,
-			oldIndexHashKey:   db.genIndexHashKey(oldRecord.Data),
-			oldIndexHashField: oldRecord.Data,
-			newIndexHashKey:   db.genIndexHashKey(r.Data),
-			newIndexHashField: r.Data,
-			newIndexHashValue: nID,
-		}
-		updateInfos = append(updateInfos, info)
-	}
-
-	// Prepare pipelined transaction.
-	db.c.Send("MULTI")
-	alreadySendMULTI = true
-
-	for _, info := range updateInfos {
-		db.c.Send("HSET", info.recordHashKey, info.recordHashField, info.recordHashValue)
-		db.c.Send("HSET", info.newIndexHashKey, info.newIndexHashField, info.newIndexHashValue)
-		db.c.Send("HDEL", info.oldIndexHashKey, info.oldIndexHashField)
-	}
-
-	if ret, err = db.c.Do("EXEC"); err != nil {
+	if _, err = db.update(OpBatchUpdate, records, false, nil); err != nil {
 		goto end
 	}
 
-	debugPrintf("BatchUpdate() ok. ret: %v\n", ret)
+	debugPrintf("BatchUpdate() ok. records: %v\n", records)
 
 end:
 	if err != nil {
-		if alreadySendMULTI {
-			db.c.Do("DISCARD")
-		}
 		debugPrintf("BatchUpdate() error: %v\n", err)
 		return err
 	}
@@ -525,79 +422,31 @@ end:
 
 // Delete deletes the record in database by given id.
 func (db *DB) Delete(id string) (err error) {
-	return db.BatchDelete([]string{id})
+	if _, err = db.delete(OpDelete, []string{id}, false, db.softDelete, nil); err != nil {
+		debugPrintf("Delete() error: %v\n", err)
+		return err
+	}
+
+	return nil
 }
 
 // BatchDelete deletes multiple records in database by given ids.
+// All records are deleted in one transaction. It fails if any id does not exist.
+// Records are moved to the trash instead of being deleted permanently in soft-delete mode(see SetSoftDelete()).
 func (db *DB) BatchDelete(ids []string) (err error) {
-	type delInfo struct {
-		recordHashKey   string
-		recordHashField uint64
-		indexHashKey    string
-		indexHashField  string
-	}
-
-	var record = Record{}
-	var nID uint64
-	var ret interface{}
-	delInfos := []delInfo{}
-	exists := false
-	alreadySendMULTI := false
-
-	// Check Id
-	for _, id := range ids {
-		if exists, err = db.IDExists(id); err != nil {
-			goto end
-		}
-
-		if !exists {
-			err = fmt.Errorf("id:%v does not exist", id)
-			goto end
-		}
-
-		if record, err = db.Get(id); err != nil {
-			goto end
-		}
-
-		if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
-			goto end
-		}
-
-		info := delInfo{
-			recordHashKey:   db.genRecordHashKey(nID),
-			recordHashField: nID,
-			indexHashKey:    db.genIndexHashKey(record.Data),
-			indexHashField:  record.Data,
-		}
-		delInfos = append(delInfos, info)
-	}
-
-	// Prepare pipelined transaction.
-	db.c.Send("MULTI")
-	alreadySendMULTI = true
-
-	for _, info := range delInfos {
-		db.c.Send("HDEL", info.recordHashKey, info.recordHashField)
-		db.c.Send("HDEL", info.indexHashKey, info.indexHashField)
-	}
-
-	if ret, err = db.c.Do("EXEC"); err != nil {
+	if _, err = db.delete(OpBatchDelete, ids, false, db.softDelete, nil); err != nil {
 		goto end
 	}
 
-	debugPrintf("BatchDelete() ok. ret: %v\n", ret)
+	debugPrintf("BatchDelete() ok. ids: %v\n", ids)
 
 end:
 	if err != nil {
-		if alreadySendMULTI {
-			db.c.Do("DISCARD")
-		}
 		debugPrintf("BatchDelete() error: %v\n", err)
 		return err
 	}
 
 	return nil
-
 }
 
 // Search scans all indexes(record data) in database and use the pattern of Redis "SCAN" command to find records which match the pattern.
@@ -609,6 +458,44 @@ end:
 //     Returns:
 //         ids: matched record ids.
 func (db *DB) Search(pattern string) (ids []string, err error) {
+	hc := db.newHookContext(OpSearch, nil, []string{pattern})
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if len(hc.Patterns) != 1 {
+			return fmt.Errorf("Search() needs one pattern.")
+		}
+
+		if ids, err = db.search(hc.Patterns[0]); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	}); err != nil {
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// SearchWithOptions is the same as Search() but the results are sorted and paged by the options(see SortIDs()).
+// Results are sorted by id if SortBy is empty.
+func (db *DB) SearchWithOptions(pattern string, opts SearchOptions) (ids []string, err error) {
+	if ids, err = db.Search(pattern); err != nil {
+		return []string{}, err
+	}
+
+	if ids, err = db.sortSearchResults(ids, opts, false); err != nil {
+		debugPrintf("SearchWithOptions() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// search scans all index buckets to find records which match the pattern of Redis "SCAN" command.
+func (db *DB) search(pattern string) (ids []string, err error) {
 	var cursor, subCursor uint64
 	var l int
 	var v []interface{}
@@ -616,6 +503,10 @@ func (db *DB) Search(pattern string) (ids []string, err error) {
 	items := []string{}
 	ids = []string{}
 
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
 	cursor = 0
 	for {
 		if v, err = redis.Values(db.c.Do("SCAN", cursor, "match", db.indexHashKeyScanPattern, "COUNT", 1024)); err != nil {
@@ -682,6 +573,44 @@ end:
 //     Returns:
 //         ids: matched record ids arrays. Each array contains result IDs match the pattern.
 func (db *DB) RegexpSearch(patterns []string) (ids [][]string, err error) {
+	hc := db.newHookContext(OpRegexpSearch, nil, append([]string{}, patterns...))
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if ids, err = db.regexpSearch(hc.Patterns); err != nil {
+			return err
+		}
+
+		for _, arr := range ids {
+			hc.Results = append(hc.Results, idRecords(arr)...)
+		}
+		return nil
+	}); err != nil {
+		return [][]string{}, err
+	}
+
+	return ids, nil
+}
+
+// RegexpSearchWithOptions is the same as RegexpSearch() but the results of each pattern are sorted and paged by the options(see SortIDs()).
+// Results are sorted by id if SortBy is empty.
+func (db *DB) RegexpSearchWithOptions(patterns []string, opts SearchOptions) (ids [][]string, err error) {
+	if ids, err = db.RegexpSearch(patterns); err != nil {
+		return [][]string{}, err
+	}
+
+	for i := range ids {
+		if ids[i], err = db.sortSearchResults(ids[i], opts, false); err != nil {
+			debugPrintf("RegexpSearchWithOptions() error: %v\n", err)
+			return [][]string{}, err
+		}
+	}
+
+	return ids, nil
+}
+
+// regexpSearch scans all index buckets to find records which match the regexp patterns.
+func (db *DB) regexpSearch(patterns []string) (ids [][]string, err error) {
 	var cursor, subCursor uint64
 	var l int
 	var v []interface{}
@@ -689,6 +618,10 @@ func (db *DB) RegexpSearch(patterns []string) (ids [][]string, err error) {
 	items := []string{}
 	reArr := []*regexp.Regexp{}
 
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
 	for _, p := range patterns {
 		reArr = append(reArr, regexp.MustCompile(p))
 		ids = append(ids, []string{})
@@ -777,12 +710,46 @@ end:
 	return count, nil
 }
 
+// forEachRecord calls fn with the id and data of each record bucket by bucket. It stops at the first error returned by fn.
+func (db *DB) forEachRecord(fn func(id uint64, data string) error) (err error) {
+	var maxBucketID, nID uint64
+	var m map[string]string
+
+	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
+		return err
+	}
+
+	for i := uint64(1); i <= maxBucketID; i++ {
+		if m, err = redis.StringMap(db.c.Do("HGETALL", fmt.Sprintf("%v/bucket/%v", db.name, i))); err != nil {
+			return err
+		}
+
+		for id, v := range m {
+			if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+				return err
+			}
+
+			if v, err = db.decodeData(v); err != nil {
+				return err
+			}
+
+			if err = fn(nID, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // Info returns the information of current DB.
 //
 //     Returns:
 //         infoMap: key: section, value: information.
+//     Comments:
+//         "compression ratio" is the stored size / data size of records computed by decoding records(see GetCompressionStats()).
+//         It's "unknown(<error>)" if records can not be decoded. Ex: encrypted database without SetEncryption().
 func (db *DB) Info() (infoMap map[string]string, err error) {
-	var maxID, maxBucketID, recordBucketNum, recordNum, indexBucketNum, indexNum, n, cursor uint64
+	var layoutVersion, maxID, maxBucketID, recordBucketNum, recordNum, indexBucketNum, indexNum, trashNum, n, cursor uint64
 	var recordHashKey string
 	ret := ""
 	encoding := ""
@@ -795,6 +762,20 @@ func (db *DB) Info() (infoMap map[string]string, err error) {
 	keys := []string{}
 	infoMap = make(map[string]string)
 	var v []interface{}
+	var values []string
+	var compressionStats CompressionStats
+	// Error of decoding records. Compression stats are unknown if the records can not be decoded.
+	var compressionErr error
+	overflowIDs := []string{}
+
+	if layoutVersion, err = db.GetLayoutVersion(); err != nil {
+		goto end
+	}
+	infoMap["layout version"] = strconv.FormatUint(layoutVersion, 10)
+
+	if infoMap["bucket mapping"], err = db.getBucketMapping(); err != nil {
+		goto end
+	}
 
 	if maxID, err = db.GetMaxID(); err != nil {
 		goto end
@@ -832,6 +813,15 @@ func (db *DB) Info() (infoMap map[string]string, err error) {
 			if encoding == "hashtable" {
 				hashTableEncodingRecordHashKeys = append(hashTableEncodingRecordHashKeys, recordHashKey)
 			}
+
+			// Compute compression stats in the same pass.
+			// Encryption keys(see SetEncryption()) and the compression dictionary are needed to decode records.
+			if compressionErr == nil {
+				if values, err = redis.Strings(db.c.Do("HVALS", recordHashKey)); err != nil {
+					goto end
+				}
+				compressionErr = db.addCompressionStats(&compressionStats, values)
+			}
 		}
 	}
 
@@ -876,6 +866,14 @@ func (db *DB) Info() (infoMap map[string]string, err error) {
 		}
 	}
 
+	if trashNum, err = redis.Uint64(db.c.Do("ZCARD", db.genTrashTimeKey())); err != nil {
+		goto end
+	}
+
+	if overflowIDs, err = db.ListOverflow(); err != nil {
+		goto end
+	}
+
 	if len(hashTableEncodingRecordHashKeys) > 0 {
 		allRecordBucketEncodingAreZipList = false
 	}
@@ -886,14 +884,25 @@ func (db *DB) Info() (infoMap map[string]string, err error) {
 
 	infoMap["db.name"] = db.name
 	infoMap["db.redisHashMaxZiplistEntries"] = strconv.FormatUint(db.redisHashMaxZiplistEntries, 10)
+	infoMap["db.redisHashMaxZiplistValue"] = strconv.FormatUint(db.redisHashMaxZiplistValue, 10)
 	infoMap["record bucket num"] = strconv.FormatUint(recordBucketNum, 10)
 	infoMap["record num"] = strconv.FormatUint(recordNum, 10)
 	infoMap["index bucket num"] = strconv.FormatUint(indexBucketNum, 10)
 	infoMap["index num"] = strconv.FormatUint(indexNum, 10)
+	infoMap["trash num"] = strconv.FormatUint(trashNum, 10)
+	if compressionErr == nil {
+		infoMap["compressed record num"] = strconv.FormatUint(compressionStats.CompressedRecordNum, 10)
+		infoMap["record data size"] = strconv.FormatUint(compressionStats.DataSize, 10)
+		infoMap["record stored size"] = strconv.FormatUint(compressionStats.StoredSize, 10)
+		infoMap["compression ratio"] = strconv.FormatFloat(compressionStats.Ratio, 'f', 3, 64)
+	} else {
+		infoMap["compression ratio"] = fmt.Sprintf("unknown(%v)", compressionErr)
+	}
 	infoMap["all record bucket encoding are 'ziplist'"] = fmt.Sprintf("%v", allRecordBucketEncodingAreZipList)
 	infoMap["all index bucket encoding are 'ziplist'"] = fmt.Sprintf("%v", allIndexBucketEncodingAreZipList)
 	infoMap[fmt.Sprintf("hashtable encoding record hash keys(%v)", len(hashTableEncodingRecordHashKeys))] = fmt.Sprintf("%v", hashTableEncodingRecordHashKeys)
 	infoMap[fmt.Sprintf("hashtable encoding index hash keys(%v)", len(hashTableEncodingIndexHashKeys))] = fmt.Sprintf("%v", hashTableEncodingIndexHashKeys)
+	infoMap[fmt.Sprintf("overflow record ids(%v)", len(overflowIDs))] = fmt.Sprintf("%v", overflowIDs)
 
 end:
 	if err != nil {
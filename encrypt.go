@@ -0,0 +1,413 @@
+package simpledb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// encodedEncrypted is the codec byte of encrypted values.
+	// Format: NUL, 'e', length of key ID(1 byte), key ID, nonce, AES-GCM sealed value returned by compressData().
+	encodedEncrypted byte = 'e'
+	// EncryptionAESGCM is the encryption algorithm stored in the meta data.
+	EncryptionAESGCM = "aes-gcm"
+	// MaxKeyIDLength is the max length of key IDs.
+	MaxKeyIDLength = 255
+)
+
+var (
+	// ErrEncryptionRequired is returned when the database is encrypted but the encryption is not set by SetEncryption().
+	ErrEncryptionRequired = errors.New("Database is encrypted. Call SetEncryption() first.")
+	// ErrSearchUnavailable is returned by Search(), RegexpSearch() and WatchPattern() when the database is encrypted.
+	// Index buckets store keyed HMACs instead of record data, only exact lookups(Exists()) work.
+	ErrSearchUnavailable = errors.New("Pattern search is unavailable for encrypted database.")
+)
+
+// KeyProvider provides AES keys for encryption. Keys should be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key to encrypt new data.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key by ID to decrypt data. Old keys should be provided until all data are re-encrypted by RotateKeys().
+	Key(id string) (key []byte, err error)
+}
+
+// StaticKeyProvider provides keys from a map.
+type StaticKeyProvider struct {
+	// CurrentID is the ID of the key to encrypt new data.
+	CurrentID string
+	// Keys contains all keys. Key: key ID, value: key.
+	Keys map[string][]byte
+}
+
+// CurrentKey returns the key of CurrentID.
+func (p *StaticKeyProvider) CurrentKey() (id string, key []byte, err error) {
+	if key, err = p.Key(p.CurrentID); err != nil {
+		return "", nil, err
+	}
+	return p.CurrentID, key, nil
+}
+
+// Key returns the key by ID.
+func (p *StaticKeyProvider) Key(id string) (key []byte, err error) {
+	var ok bool
+
+	if key, ok = p.Keys[id]; !ok {
+		return nil, fmt.Errorf("Key %v not found.", id)
+	}
+	return key, nil
+}
+
+// Encryption is the encryption setting of record data.
+type Encryption struct {
+	// Keys provides AES keys to encrypt and decrypt record data.
+	Keys KeyProvider
+	// IndexKey is the key of HMAC-SHA256 stored in index buckets instead of record data.
+	// It should never change because the index is not rebuilt.
+	IndexKey []byte
+}
+
+// SetEncryption sets the encryption of record data.
+// Record values(including the trash and the history) are encrypted by AES-GCM with the current key of the key provider,
+// and index buckets store keyed HMACs of record data so that Exists(), uniqueness checks and exact lookups still work.
+// Glob / regexp pattern search(Search(), RegexpSearch() and WatchPattern()) are unavailable and return ErrSearchUnavailable.
+// Record data in the change feed and watch notifications is encrypted too, and decrypted by Subscribe(), SubscribeGroup() and Watch().
+//
+// The database is marked as encrypted in the meta data. Encryption can only be enabled when the database is empty.
+// All clients should call SetEncryption() with the same index key after Open().
+func (db *DB) SetEncryption(e *Encryption) (err error) {
+	var key []byte
+
+	if e == nil || e.Keys == nil || len(e.IndexKey) == 0 {
+		err = fmt.Errorf("Key provider and index key are required.")
+		goto end
+	}
+
+	// Check the current key.
+	if _, key, err = e.Keys.CurrentKey(); err != nil {
+		goto end
+	}
+
+	if _, err = aes.NewCipher(key); err != nil {
+		goto end
+	}
+
+	if _, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		var maxID uint64
+		var algorithm string
+		var err error
+
+		if algorithm, err = redis.String(db.c.Do("HGET", db.genMetaKey(), metaFieldEncryption)); err != nil && err != redis.ErrNil {
+			return err
+		}
+
+		if algorithm == EncryptionAESGCM {
+			return nil
+		}
+
+		if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
+			return err
+		}
+
+		if maxID > 0 {
+			return fmt.Errorf("Encryption can not be enabled: database is not empty.")
+		}
+
+		t.send("HSET", db.genMetaKey(), metaFieldEncryption, EncryptionAESGCM)
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+	db.encrypted = true
+	db.encryption = &Encryption{Keys: e.Keys, IndexKey: append([]byte{}, e.IndexKey...)}
+
+end:
+	if err != nil {
+		debugPrintf("SetEncryption() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// loadEncrypted reads whether the database is encrypted from the meta data.
+func (db *DB) loadEncrypted() (err error) {
+	var algorithm string
+
+	if algorithm, err = redis.String(db.c.Do("HGET", db.genMetaKey(), metaFieldEncryption)); err != nil {
+		if err == redis.ErrNil {
+			return nil
+		}
+		return err
+	}
+
+	if algorithm != EncryptionAESGCM {
+		return fmt.Errorf("Unsupported encryption: %v.", algorithm)
+	}
+
+	db.encrypted = true
+	return nil
+}
+
+// checkEncryption returns ErrEncryptionRequired if the database is encrypted but the encryption is not set.
+func (db *DB) checkEncryption() error {
+	if db.encrypted && db.encryption == nil {
+		return ErrEncryptionRequired
+	}
+	return nil
+}
+
+// checkSearch returns ErrSearchUnavailable if the database is encrypted.
+func (db *DB) checkSearch() error {
+	if db.encrypted {
+		return ErrSearchUnavailable
+	}
+	return nil
+}
+
+// genIndexHashField generates the field of the index bucket by given record data.
+// It's the data itself or the keyed HMAC of the data if the database is encrypted.
+func (db *DB) genIndexHashField(data string) string {
+	if db.encryption == nil {
+		return data
+	}
+
+	mac := hmac.New(sha256.New, db.encryption.IndexKey)
+	mac.Write([]byte(data))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newAEAD creates the AES-GCM cipher by given key.
+func newAEAD(key []byte) (aead cipher.AEAD, err error) {
+	var block cipher.Block
+
+	if block, err = aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptData encrypts the value with the current key if encryption is set.
+func (db *DB) encryptData(v string) (encrypted string, err error) {
+	var keyID string
+	var key []byte
+	var aead cipher.AEAD
+
+	if err = db.checkEncryption(); err != nil || db.encryption == nil {
+		return v, err
+	}
+
+	if keyID, key, err = db.encryption.Keys.CurrentKey(); err != nil {
+		return "", err
+	}
+
+	if len(keyID) > MaxKeyIDLength {
+		return "", fmt.Errorf("Key ID is too long: %v.", keyID)
+	}
+
+	if aead, err = newAEAD(key); err != nil {
+		return "", err
+	}
+
+	buf := []byte{encodedMark, encodedEncrypted, byte(len(keyID))}
+	buf = append(buf, keyID...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	buf = append(buf, nonce...)
+
+	return string(aead.Seal(buf, nonce, []byte(v), nil)), nil
+}
+
+// parseEncrypted parses the nonce and sealed value of the encrypted value.
+func parseEncrypted(v string, nonceSize int) (nonce, sealed []byte, err error) {
+	n := int(v[2])
+	if len(v) < 3+n+nonceSize {
+		return nil, nil, fmt.Errorf("Invalid encrypted data.")
+	}
+
+	nonce = []byte(v[3+n : 3+n+nonceSize])
+	sealed = []byte(v[3+n+nonceSize:])
+	return nonce, sealed, nil
+}
+
+// encryptedKeyID returns the key ID of the encrypted value. It returns false if the value is not encrypted.
+func encryptedKeyID(v string) (keyID string, ok bool) {
+	if len(v) < 3 || v[0] != encodedMark || v[1] != encodedEncrypted || len(v) < 3+int(v[2]) {
+		return "", false
+	}
+	return v[3 : 3+int(v[2])], true
+}
+
+// decryptData decrypts the value if it's encrypted.
+func (db *DB) decryptData(v string) (decrypted string, err error) {
+	var keyID string
+	var key, nonce, sealed, buf []byte
+	var aead cipher.AEAD
+	var ok bool
+
+	if keyID, ok = encryptedKeyID(v); !ok {
+		return v, nil
+	}
+
+	if db.encryption == nil {
+		return "", ErrEncryptionRequired
+	}
+
+	if key, err = db.encryption.Keys.Key(keyID); err != nil {
+		return "", err
+	}
+
+	if aead, err = newAEAD(key); err != nil {
+		return "", err
+	}
+
+	if nonce, sealed, err = parseEncrypted(v, aead.NonceSize()); err != nil {
+		return "", err
+	}
+
+	if buf, err = aead.Open(nil, nonce, sealed, nil); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// encodeData encodes the record data to store in Redis: compress and then encrypt.
+func (db *DB) encodeData(data string) (v string, err error) {
+	return db.encryptData(db.compressData(data))
+}
+
+// decodeData decodes the value stored in Redis to record data: load the overflow value(see SetOversizePolicy()), decrypt and then decompress.
+func (db *DB) decodeData(v string) (data string, err error) {
+	var inner string
+
+	if v, err = db.loadOverflow(v); err != nil {
+		return "", err
+	}
+
+	if inner, err = db.decryptData(v); err != nil {
+		return "", err
+	}
+	return db.decompressData(inner)
+}
+
+// reencrypt re-encrypts the value with the current key. It returns false if the value is already encrypted by the current key.
+func (db *DB) reencrypt(v, currentKeyID string) (newValue string, changed bool, err error) {
+	var data string
+
+	if keyID, ok := encryptedKeyID(v); ok && keyID == currentKeyID {
+		return v, false, nil
+	}
+
+	if data, err = db.decodeData(v); err != nil {
+		return "", false, err
+	}
+
+	if newValue, err = db.encodeData(data); err != nil {
+		return "", false, err
+	}
+	return newValue, true, nil
+}
+
+// rotateBucket re-encrypts the values of the hash which are not encrypted by the current key in one transaction.
+func (db *DB) rotateBucket(k, currentKeyID string) (n uint64, err error) {
+	_, err = db.doTx([]string{k}, func(t *tx) error {
+		var m map[string]string
+		var err error
+		var newValue string
+		var changed bool
+
+		n = 0
+		if m, err = redis.StringMap(db.c.Do("HGETALL", k)); err != nil {
+			return err
+		}
+
+		for field, v := range m {
+			// Re-encrypt the value in the overflow key and keep the reference.
+			overflowKey, overflow := db.parseOverflowKey(v)
+			if overflow {
+				if err = db.watch(overflowKey); err != nil {
+					return err
+				}
+
+				if v, err = db.loadOverflow(v); err != nil {
+					return err
+				}
+			}
+
+			if newValue, changed, err = db.reencrypt(v, currentKeyID); err != nil {
+				return fmt.Errorf("Re-encrypt %v of %v error: %v", field, k, err)
+			}
+
+			if !changed {
+				continue
+			}
+
+			if overflow {
+				t.send("SET", overflowKey, newValue)
+			} else {
+				t.send("HSET", k, field, newValue)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// RotateKeys re-encrypts the records and the trashed records which are not encrypted by the current key of the key provider.
+// It should be called after the current key is changed. Old keys can be removed from the key provider after it returns,
+// except for the revisions in the history which keep the keys when they're stored.
+//
+//	Returns:
+//	    n: number of re-encrypted records.
+func (db *DB) RotateKeys() (n uint64, err error) {
+	var maxBucketID, count uint64
+	var currentKeyID string
+
+	if !db.encrypted || db.encryption == nil {
+		err = ErrEncryptionRequired
+		goto end
+	}
+
+	if currentKeyID, _, err = db.encryption.Keys.CurrentKey(); err != nil {
+		goto end
+	}
+
+	if maxBucketID, err = db.GetMaxBucketID(); err != nil {
+		goto end
+	}
+
+	for i := uint64(1); i <= maxBucketID; i++ {
+		for _, k := range []string{
+			fmt.Sprintf("%v/bucket/%v", db.name, i),
+			fmt.Sprintf("%v/trash/bucket/%v", db.name, i),
+		} {
+			if count, err = db.rotateBucket(k, currentKeyID); err != nil {
+				goto end
+			}
+			n += count
+		}
+	}
+
+	debugPrintf("RotateKeys() ok. n: %v\n", n)
+
+end:
+	if err != nil {
+		debugPrintf("RotateKeys() error: %v\n", err)
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,65 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetEncryption() {
+	var err error
+	var db *simpledb.DB
+	var id string
+	var r simpledb.Record
+	var exists bool
+	var n uint64
+
+	log.Printf("\n")
+	log.Printf("--------- SetEncryption() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "encrypt-test")
+	defer db.Close()
+
+	// Keys should be loaded from a secret store in production.
+	keys := &simpledb.StaticKeyProvider{
+		CurrentID: "2020-01",
+		Keys: map[string][]byte{
+			"2020-01": []byte("0123456789abcdef0123456789abcdef"),
+			"2020-02": []byte("fedcba9876543210fedcba9876543210"),
+		},
+	}
+
+	if err = db.SetEncryption(&simpledb.Encryption{Keys: keys, IndexKey: []byte("index-key")}); err != nil {
+		goto end
+	}
+
+	if id, err = db.Create(`{"name":"Jacky","tel":"13800138000"}`); err != nil {
+		goto end
+	}
+
+	// Get decrypts the data transparently.
+	if r, err = db.Get(id); err != nil {
+		goto end
+	}
+	log.Printf("record: %v\n", r)
+
+	// Exact lookups still work.
+	if exists, err = db.Exists(`{"name":"Jacky","tel":"13800138000"}`); err != nil {
+		goto end
+	}
+	log.Printf("exists: %v\n", exists)
+
+	// Rotate keys: change the current key and re-encrypt records.
+	keys.CurrentID = "2020-02"
+	if n, err = db.RotateKeys(); err != nil {
+		goto end
+	}
+	log.Printf("%v records re-encrypted\n", n)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetEncryption() Test End --------\n")
+	// Output:
+}
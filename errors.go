@@ -0,0 +1,24 @@
+package simpledb
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTruncating is returned by write operations when the database is being truncated.
+	ErrTruncating = errors.New("Database is being truncated.")
+)
+
+// DataExistsError is returned when the record data is already owned by another record.
+type DataExistsError struct {
+	// Data is the record data.
+	Data string
+	// ID is the ID of the record which owns the data.
+	ID string
+}
+
+// Error returns the error message.
+func (e *DataExistsError) Error() string {
+	return fmt.Sprintf("Data already exists in db with id %v: %v.", e.ID, e.Data)
+}
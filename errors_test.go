@@ -0,0 +1,51 @@
+package simpledb_test
+
+import (
+	"errors"
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDataExistsError() {
+	var err error
+	var db *simpledb.DB
+	var existsErr *simpledb.DataExistsError
+	ids := []string{}
+
+	log.Printf("\n")
+	log.Printf("--------- DataExistsError Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "errors-test")
+	defer db.Close()
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Jack","tel":"13900139021"}`,
+		`{"name":"Kate","tel":"13900139022"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Updating a record with its current data is a no-op.
+	if err = db.Update(simpledb.Record{ID: ids[0], Data: `{"name":"Jack","tel":"13900139021"}`}); err != nil {
+		goto end
+	}
+
+	// The data is owned by ids[0].
+	err = db.Update(simpledb.Record{ID: ids[1], Data: `{"name":"Jack","tel":"13900139021"}`})
+	if errors.As(err, &existsErr) {
+		log.Printf("data: %v is owned by id: %v\n", existsErr.Data, existsErr.ID)
+		err = nil
+	}
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- DataExistsError Test End --------\n")
+	// Output:
+}
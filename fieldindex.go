@@ -0,0 +1,669 @@
+package simpledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// IndexKind is the kind of field indexes.
+type IndexKind string
+
+const (
+	// IndexPrefix indexes string and number values of the field in lexicographical order for PrefixSearch().
+	IndexPrefix IndexKind = "prefix"
+	// IndexNumber indexes number values of the field by value for RangeSearch().
+	IndexNumber IndexKind = "number"
+	// IndexTime indexes time values of the field by Unix milliseconds for RangeSearch().
+	// Values should be strings in RFC 3339(Ex: "2026-01-02T15:04:05Z") or date("2026-01-02", UTC) format.
+	IndexTime IndexKind = "time"
+	// IndexCount maintains the number of records of each string, number and bool value of the field for Aggregate().
+	IndexCount IndexKind = "count"
+)
+
+// fieldIndex is an index of a JSON field.
+type fieldIndex struct {
+	field string
+	kind  IndexKind
+}
+
+// fieldIndexDef is the JSON format of a field index stored in the meta data.
+type fieldIndexDef struct {
+	Field string    `json:"field"`
+	Kind  IndexKind `json:"kind"`
+}
+
+// getFieldIndexes gets the field indexes stored in the meta data.
+func (db *DB) getFieldIndexes() (indexes []fieldIndex, err error) {
+	var buf []byte
+	var defs []fieldIndexDef
+
+	if buf, err = redis.Bytes(db.c.Do("HGET", db.genMetaKey(), metaFieldFieldIndexes)); err != nil {
+		if err == redis.ErrNil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(buf, &defs); err != nil {
+		return nil, err
+	}
+
+	for _, def := range defs {
+		indexes = append(indexes, fieldIndex{field: def.Field, kind: def.Kind})
+	}
+	return indexes, nil
+}
+
+// queueSetFieldIndexes queues the command to store the field indexes in the meta data in the transaction.
+func (db *DB) queueSetFieldIndexes(t *tx, indexes []fieldIndex) (err error) {
+	var buf []byte
+	defs := []fieldIndexDef{}
+
+	for _, idx := range indexes {
+		defs = append(defs, fieldIndexDef{Field: idx.field, Kind: idx.kind})
+	}
+
+	if buf, err = json.Marshal(defs); err != nil {
+		return err
+	}
+
+	t.send("HSET", db.genMetaKey(), metaFieldFieldIndexes, buf)
+	return nil
+}
+
+// loadFieldIndexes reads the field indexes from the meta data.
+func (db *DB) loadFieldIndexes() (err error) {
+	db.fieldIndexes, err = db.getFieldIndexes()
+	return err
+}
+
+// AddFieldIndex adds an index of the JSON field.
+// Every create, update and delete maintains the indexes in the same transaction.
+// The index is stored in the meta data and loaded by Open(), so all clients maintain it once they open the database.
+// Clients which have already opened the database should reopen it. Call RebuildFieldIndex() to index existing records.
+// Field indexes are not maintained for encrypted databases(see SetEncryption()).
+//
+//	Params:
+//	    field: path of the field. Nested fields are separated by ".". Ex: "name", "address.city".
+//	           Each item is indexed if the value is an array.
+//	    kind: index kind: IndexPrefix, IndexNumber, IndexTime or IndexCount.
+func (db *DB) AddFieldIndex(field string, kind IndexKind) (err error) {
+	var indexes []fieldIndex
+
+	if len(field) == 0 {
+		err = fmt.Errorf("Empty field.")
+		goto end
+	}
+
+	switch kind {
+	case IndexPrefix, IndexNumber, IndexTime, IndexCount:
+	default:
+		err = fmt.Errorf("Unsupported index kind: %v.", kind)
+		goto end
+	}
+
+	if _, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		var err error
+
+		if indexes, err = db.getFieldIndexes(); err != nil {
+			return err
+		}
+
+		for _, idx := range indexes {
+			if idx.field == field && idx.kind == kind {
+				return nil
+			}
+		}
+
+		indexes = append(indexes, fieldIndex{field: field, kind: kind})
+		return db.queueSetFieldIndexes(t, indexes)
+	}); err != nil {
+		goto end
+	}
+
+	db.fieldIndexes = indexes
+
+end:
+	if err != nil {
+		debugPrintf("AddFieldIndex() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// DropFieldIndex removes the index of the field from the meta data and deletes the index.
+// Clients which have already opened the database should reopen it.
+func (db *DB) DropFieldIndex(field string, kind IndexKind) (err error) {
+	var indexes []fieldIndex
+
+	if _, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		var current []fieldIndex
+		var err error
+		found := false
+
+		if current, err = db.getFieldIndexes(); err != nil {
+			return err
+		}
+
+		indexes = []fieldIndex{}
+		for _, idx := range current {
+			if idx.field == field && idx.kind == kind {
+				found = true
+				t.send("DEL", db.genFieldIndexKey(idx))
+				continue
+			}
+			indexes = append(indexes, idx)
+		}
+
+		if !found {
+			return fmt.Errorf("Field %v has no %v index.", field, kind)
+		}
+
+		return db.queueSetFieldIndexes(t, indexes)
+	}); err != nil {
+		goto end
+	}
+
+	db.fieldIndexes = indexes
+
+end:
+	if err != nil {
+		debugPrintf("DropFieldIndex() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// findFieldIndex finds the index of the field by kind.
+func (db *DB) findFieldIndex(field string, kind IndexKind) (idx fieldIndex, ok bool) {
+	for _, idx = range db.fieldIndexes {
+		if idx.field == field && idx.kind == kind {
+			return idx, true
+		}
+	}
+	return fieldIndex{}, false
+}
+
+// genFieldIndexKey generates the key of the field index.
+// It's a sorted set. Member: value + NUL + record id.
+// Score: 0 for IndexPrefix, the number for IndexNumber and Unix milliseconds for IndexTime.
+// It's a hash for IndexCount. Field: value, value: number of records.
+func (db *DB) genFieldIndexKey(idx fieldIndex) string {
+	return fmt.Sprintf("%v/fidx/%v/%v", db.name, idx.kind, idx.field)
+}
+
+// decodeJSON decodes the record data. Numbers are decoded as json.Number to keep the original text.
+// It returns false if the data is not valid JSON.
+func decodeJSON(data string) (v interface{}, ok bool) {
+	d := json.NewDecoder(strings.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil || d.More() {
+		return nil, false
+	}
+	return v, true
+}
+
+// getFieldValues returns the values of the field in the decoded JSON value.
+// Items are returned if the value is an array.
+func getFieldValues(v interface{}, field string) []interface{} {
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		if v, ok = m[name]; !ok {
+			return nil
+		}
+	}
+
+	if arr, ok := v.([]interface{}); ok {
+		return arr
+	}
+	return []interface{}{v}
+}
+
+// parseTime parses the time value of IndexTime indexes.
+func parseTime(s string) (t time.Time, err error) {
+	if t, err = time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// numberText returns the normalized text of the number so that equal numbers have the same text(Ex: "25" for 25.0 and 2.5e1).
+// Integers without exponent are kept exactly(Ex: large IDs), other numbers are formatted in the shortest form of float64.
+func numberText(n json.Number) string {
+	s := n.String()
+
+	if !strings.ContainsAny(s, "eE") {
+		if i := strings.IndexByte(s, '.'); i >= 0 && strings.Trim(s[i+1:], "0") == "" {
+			s = s[:i]
+		}
+
+		if i, ok := new(big.Int).SetString(s, 10); ok {
+			return i.String()
+		}
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return n.String()
+	}
+
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// fieldValueText returns the text of string, number and bool values. Numbers are normalized by numberText().
+// It returns false for other values.
+func fieldValueText(v interface{}) (text string, ok bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return numberText(v), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// genFieldIndexMembers generates the members and scores of the field index of the record data.
+// Members of IndexCount indexes are the distinct values of the field and scores are 1.
+// Values which do not match the index kind are not indexed.
+func genFieldIndexMembers(idx fieldIndex, id uint64, v interface{}) (members map[string]float64) {
+	members = make(map[string]float64)
+	suffix := "\x00" + strconv.FormatUint(id, 10)
+
+	for _, value := range getFieldValues(v, idx.field) {
+		switch idx.kind {
+		case IndexPrefix:
+			switch value := value.(type) {
+			case string:
+				members[value+suffix] = 0
+			case json.Number:
+				members[value.String()+suffix] = 0
+			}
+		case IndexNumber:
+			if n, ok := value.(json.Number); ok {
+				if f, err := n.Float64(); err == nil {
+					members[n.String()+suffix] = f
+				}
+			}
+		case IndexTime:
+			if s, ok := value.(string); ok {
+				if t, err := parseTime(s); err == nil {
+					members[s+suffix] = float64(t.UnixMilli())
+				}
+			}
+		case IndexCount:
+			if text, ok := fieldValueText(value); ok {
+				members[text] = 1
+			}
+		}
+	}
+	return members
+}
+
+// queueFieldIndexes queues the commands to update the field indexes of a record in the transaction.
+// oldData is empty for new records and data is empty for deleted records.
+// It's a no-op if there's no field index or the database is encrypted.
+func (db *DB) queueFieldIndexes(t *tx, id uint64, oldData, data string) {
+	if len(db.fieldIndexes) == 0 || db.encrypted {
+		return
+	}
+
+	oldValue, _ := decodeJSON(oldData)
+	newValue, _ := decodeJSON(data)
+
+	for _, idx := range db.fieldIndexes {
+		k := db.genFieldIndexKey(idx)
+		oldMembers := genFieldIndexMembers(idx, id, oldValue)
+		newMembers := genFieldIndexMembers(idx, id, newValue)
+
+		for m := range oldMembers {
+			if _, ok := newMembers[m]; !ok {
+				if idx.kind == IndexCount {
+					t.send("HINCRBY", k, m, -1)
+				} else {
+					t.send("ZREM", k, m)
+				}
+			}
+		}
+
+		for m, score := range newMembers {
+			if oldScore, ok := oldMembers[m]; !ok || oldScore != score {
+				if idx.kind == IndexCount {
+					t.send("HINCRBY", k, m, 1)
+				} else {
+					t.send("ZADD", k, score, m)
+				}
+			}
+		}
+	}
+}
+
+// parseFieldIndexMember returns the record id of the member of the field index.
+func parseFieldIndexMember(m string) (id string) {
+	return m[strings.LastIndexByte(m, 0)+1:]
+}
+
+// PrefixSearch finds records whose field value starts with the prefix by the index of IndexPrefix kind in one Redis call.
+// Values are compared byte by byte(case-sensitive).
+//
+//	Params:
+//	    field: field which is indexed by AddFieldIndex(field, IndexPrefix).
+//	    prefix: prefix of the value. All records which have the field are matched if it's empty.
+//	    limit: max number of ids to return. No limit if it's 0.
+//	Returns:
+//	    ids: matched record ids sorted by the values.
+//	         A record appears more than once if the field is an array and more than one item match.
+func (db *DB) PrefixSearch(field, prefix string, limit uint64) (ids []string, err error) {
+	hc := db.newHookContext(OpPrefixSearch, nil, []string{field, prefix})
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if len(hc.Patterns) != 2 {
+			return fmt.Errorf("PrefixSearch() needs the field and the prefix.")
+		}
+
+		if ids, err = db.prefixSearch(hc.Patterns[0], hc.Patterns[1], limit); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	}); err != nil {
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// prefixSearch finds records whose field value starts with the prefix by the prefix index.
+func (db *DB) prefixSearch(field, prefix string, limit uint64) (ids []string, err error) {
+	var members []string
+	var idx fieldIndex
+	var ok bool
+	args := []interface{}{}
+	ids = []string{}
+
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
+	if idx, ok = db.findFieldIndex(field, IndexPrefix); !ok {
+		err = fmt.Errorf("Field %v has no %v index.", field, IndexPrefix)
+		goto end
+	}
+
+	// "\xff" is greater than all bytes of UTF-8 strings.
+	args = append(args, db.genFieldIndexKey(idx), "["+prefix, "["+prefix+"\xff")
+	if limit > 0 {
+		args = append(args, "LIMIT", 0, limit)
+	}
+
+	if members, err = redis.Strings(db.c.Do("ZRANGEBYLEX", args...)); err != nil {
+		goto end
+	}
+
+	for _, m := range members {
+		ids = append(ids, parseFieldIndexMember(m))
+	}
+
+end:
+	if err != nil {
+		debugPrintf("PrefixSearch() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// PrefixSearchWithOptions is the same as PrefixSearch() but the results are sorted and paged by the options(see SortIDs()).
+// The order of the values is kept if SortBy is empty(reversed in descending order). Redundant ids are removed.
+func (db *DB) PrefixSearchWithOptions(field, prefix string, opts SearchOptions) (ids []string, err error) {
+	if ids, err = db.PrefixSearch(field, prefix, 0); err != nil {
+		return []string{}, err
+	}
+
+	if ids, err = db.sortSearchResults(ids, opts, true); err != nil {
+		debugPrintf("PrefixSearchWithOptions() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// RebuildFieldIndex deletes the index of the field and indexes all records again.
+// It should be called after the index is added for a database which has records,
+// or to remove zero counters of IndexCount indexes.
+// Other clients should not write records during rebuilding.
+//
+//	Returns:
+//	    n: number of indexed records.
+func (db *DB) RebuildFieldIndex(field string, kind IndexKind) (n uint64, err error) {
+	var idx fieldIndex
+	var ok bool
+	k := ""
+
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
+	if idx, ok = db.findFieldIndex(field, kind); !ok {
+		err = fmt.Errorf("Field %v has no %v index.", field, kind)
+		goto end
+	}
+
+	k = db.genFieldIndexKey(idx)
+	if err = unlinkKeys(db.c, []string{k}); err != nil {
+		goto end
+	}
+
+	if err = db.forEachRecord(func(id uint64, data string) error {
+		v, ok := decodeJSON(data)
+		if !ok {
+			return nil
+		}
+
+		members := genFieldIndexMembers(idx, id, v)
+		if len(members) == 0 {
+			return nil
+		}
+
+		if idx.kind == IndexCount {
+			for m := range members {
+				db.c.Send("HINCRBY", k, m, 1)
+			}
+
+			if _, err := db.c.Do(""); err != nil {
+				return err
+			}
+			n++
+			return nil
+		}
+
+		args := []interface{}{k}
+		for m, score := range members {
+			args = append(args, score, m)
+		}
+
+		if _, err := db.c.Do("ZADD", args...); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+	debugPrintf("RebuildFieldIndex() ok. field: %v, kind: %v, n: %v\n", field, kind, n)
+
+end:
+	if err != nil {
+		debugPrintf("RebuildFieldIndex() error: %v\n", err)
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// rangeBound is a bound of RangeSearch(). value is the number or Unix milliseconds of the time.
+type rangeBound struct {
+	value     float64
+	exclusive bool
+	unbounded bool
+}
+
+// parseRangeBound parses the bound of RangeSearch() by the index kind.
+func parseRangeBound(kind IndexKind, bound string) (b rangeBound, err error) {
+	var t time.Time
+
+	if len(bound) == 0 || bound == "-inf" || bound == "+inf" {
+		return rangeBound{unbounded: true}, nil
+	}
+
+	if strings.HasPrefix(bound, "(") {
+		b.exclusive = true
+		bound = bound[1:]
+	}
+
+	if kind == IndexTime {
+		if t, err = parseTime(bound); err != nil {
+			return rangeBound{}, fmt.Errorf("Invalid time bound: %v.", bound)
+		}
+		b.value = float64(t.UnixMilli())
+		return b, nil
+	}
+
+	if b.value, err = strconv.ParseFloat(bound, 64); err != nil {
+		return rangeBound{}, fmt.Errorf("Invalid number bound: %v.", bound)
+	}
+	return b, nil
+}
+
+// score returns the score of ZRANGEBYSCORE. inf is returned if the bound is unbounded.
+func (b rangeBound) score(inf string) string {
+	if b.unbounded {
+		return inf
+	}
+
+	score := strconv.FormatFloat(b.value, 'g', -1, 64)
+	if b.exclusive {
+		return "(" + score
+	}
+	return score
+}
+
+// inRange checks if the value is between min and max.
+func inRange(value float64, min, max rangeBound) bool {
+	if !min.unbounded && (value < min.value || min.exclusive && value == min.value) {
+		return false
+	}
+
+	if !max.unbounded && (value > max.value || max.exclusive && value == max.value) {
+		return false
+	}
+	return true
+}
+
+// RangeSearch finds records whose field value is in the range by the index of IndexNumber or IndexTime kind.
+//
+//	Params:
+//	    field: field which is indexed by AddFieldIndex(field, IndexNumber) or AddFieldIndex(field, IndexTime).
+//	    min, max: bounds of the range. They're inclusive unless they start with "(". Empty, "-inf" or "+inf" means no bound.
+//	              Bounds are numbers for IndexNumber indexes and RFC 3339 or date strings for IndexTime indexes.
+//	              Ex: "18" and "30", "(2026-01-01" and "".
+//	    limit: max number of ids to return. No limit if it's 0.
+//	    offset: number of matched ids to skip.
+//	Returns:
+//	    ids: matched record ids sorted by the values in ascending order.
+//	         A record appears more than once if the field is an array and more than one item match.
+func (db *DB) RangeSearch(field, min, max string, limit, offset uint64) (ids []string, err error) {
+	hc := db.newHookContext(OpRangeSearch, nil, []string{field, min, max})
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if len(hc.Patterns) != 3 {
+			return fmt.Errorf("RangeSearch() needs the field, min and max.")
+		}
+
+		if ids, err = db.rangeSearch(hc.Patterns[0], hc.Patterns[1], hc.Patterns[2], limit, offset); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	}); err != nil {
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// rangeSearch finds records whose field value is in the range by the number or time index.
+func (db *DB) rangeSearch(field, min, max string, limit, offset uint64) (ids []string, err error) {
+	var members []string
+	var idx fieldIndex
+	var ok bool
+	var minBound, maxBound rangeBound
+	args := []interface{}{}
+	ids = []string{}
+
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
+	if idx, ok = db.findFieldIndex(field, IndexNumber); !ok {
+		if idx, ok = db.findFieldIndex(field, IndexTime); !ok {
+			err = fmt.Errorf("Field %v has no %v or %v index.", field, IndexNumber, IndexTime)
+			goto end
+		}
+	}
+
+	if minBound, err = parseRangeBound(idx.kind, min); err != nil {
+		goto end
+	}
+
+	if maxBound, err = parseRangeBound(idx.kind, max); err != nil {
+		goto end
+	}
+
+	args = append(args, db.genFieldIndexKey(idx), minBound.score("-inf"), maxBound.score("+inf"))
+	if limit > 0 || offset > 0 {
+		count := int64(-1)
+		if limit > 0 {
+			count = int64(limit)
+		}
+		args = append(args, "LIMIT", offset, count)
+	}
+
+	if members, err = redis.Strings(db.c.Do("ZRANGEBYSCORE", args...)); err != nil {
+		goto end
+	}
+
+	for _, m := range members {
+		ids = append(ids, parseFieldIndexMember(m))
+	}
+
+end:
+	if err != nil {
+		debugPrintf("RangeSearch() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
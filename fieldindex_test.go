@@ -0,0 +1,105 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_PrefixSearch() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched []string
+
+	log.Printf("\n")
+	log.Printf("--------- PrefixSearch() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "prefix-test")
+	defer db.Close()
+
+	if err = db.AddFieldIndex("name", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Frank","tel":"13700137001"}`,
+		`{"name":"Fred","tel":"13700137002"}`,
+		`{"name":"Francis","tel":"13700137003"}`,
+		`{"name":"George","tel":"13700137004"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Get the first 2 records whose names start with "Fr" sorted by names: Francis, Frank.
+	if matched, err = db.PrefixSearch("name", "Fr", 2); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+	// The index is stored in the meta data until it's dropped.
+	if err = db.DropFieldIndex("name", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- PrefixSearch() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_RangeSearch() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched []string
+
+	log.Printf("\n")
+	log.Printf("--------- RangeSearch() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "range-test")
+	defer db.Close()
+
+	if err = db.AddFieldIndex("age", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+	if err = db.AddFieldIndex("created", simpledb.IndexTime); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Alice","age":17,"created":"2025-12-30T08:00:00Z"}`,
+		`{"name":"Bob","age":25,"created":"2026-01-05T09:30:00Z"}`,
+		`{"name":"Carol","age":30,"created":"2026-02-01T10:00:00Z"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Age between 18 and 30.
+	if matched, err = db.RangeSearch("age", "18", "30", 0, 0); err != nil {
+		goto end
+	}
+	log.Printf("age between 18 and 30: %v\n", matched)
+
+	// Created after 2026-01-01. Skip the first one.
+	if matched, err = db.RangeSearch("created", "(2026-01-01", "", 10, 1); err != nil {
+		goto end
+	}
+	log.Printf("created after 2026-01-01(offset 1): %v\n", matched)
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- RangeSearch() Test End --------\n")
+	// Output:
+}
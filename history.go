@@ -0,0 +1,222 @@
+package simpledb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Revision is a previous version of a record stored in the history.
+type Revision struct {
+	// Rev is the revision number. It starts from 1 and increases by 1 for each revision of the record.
+	// It's not reset when the record is deleted and created again(Ex: by Revert() or Restore()).
+	Rev uint64
+	// Time is the time when the data is replaced or deleted.
+	Time time.Time
+	// Data is the previous record data.
+	Data string
+}
+
+// revisionEntry is the JSON format of a revision stored in Redis.
+type revisionEntry struct {
+	Rev  uint64 `json:"rev"`
+	Time int64  `json:"time"` // Unix milliseconds.
+	Data string `json:"data"`
+	// Sealed is true if Data is the base64 encoded encrypted data(see SetEncryption()).
+	Sealed bool `json:"sealed,omitempty"`
+}
+
+// SetHistory sets history mode.
+// In history mode, every update or delete appends the previous data with a timestamp and revision number to the history of the record.
+//
+//	Params:
+//	    maxRevisions: max revisions kept in the history of each record. History mode is disabled if it's 0.
+func (db *DB) SetHistory(maxRevisions int) {
+	if maxRevisions < 0 {
+		maxRevisions = 0
+	}
+	db.maxRevisions = maxRevisions
+}
+
+// genHistoryKey generates the key of the history of given record id.
+// It's a list. The newest revision is at the head.
+func (db *DB) genHistoryKey(id uint64) string {
+	return fmt.Sprintf("%v/history/%v", db.name, id)
+}
+
+// genRevisionHashKey generates the revision counter hash(bucket) key by given record id.
+// Field: record id, value: the last revision number of the record.
+// Counters are kept when records are deleted so that revision numbers never repeat.
+func (db *DB) genRevisionHashKey(id uint64) string {
+	bucketID := db.computeBucketID(id)
+	return fmt.Sprintf("%v/rev/bucket/%v", db.name, bucketID)
+}
+
+// getLastRev gets the last revision number of the record in a transaction.
+// History appended before revision counters are kept continues from the revision number of the newest revision.
+func (db *DB) getLastRev(id uint64) (rev uint64, err error) {
+	var item []byte
+	var entry revisionEntry
+
+	if rev, err = redis.Uint64(db.c.Do("HGET", db.genRevisionHashKey(id), id)); err == nil {
+		return rev, nil
+	}
+
+	if err != redis.ErrNil {
+		return 0, err
+	}
+
+	if item, err = redis.Bytes(db.c.Do("LINDEX", db.genHistoryKey(id), 0)); err != nil {
+		if err == redis.ErrNil {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if err = json.Unmarshal(item, &entry); err != nil {
+		return 0, err
+	}
+	return entry.Rev, nil
+}
+
+// queueHistory queues the commands to append the previous data of a record to its history in the transaction.
+// It's a no-op if history mode is disabled.
+func (db *DB) queueHistory(t *tx, id uint64, data string) (err error) {
+	var rev uint64
+	var buf []byte
+	var sealed string
+	now := time.Now()
+	entry := revisionEntry{Time: now.UnixMilli(), Data: data}
+	k := db.genHistoryKey(id)
+
+	if db.maxRevisions <= 0 {
+		return nil
+	}
+
+	// Watch the revision counter and the history to make sure the revision number is not used by others.
+	if err = db.watch(db.genRevisionHashKey(id), k); err != nil {
+		return err
+	}
+
+	if rev, err = db.getLastRev(id); err != nil {
+		return err
+	}
+
+	entry.Rev = rev + 1
+
+	if db.encrypted {
+		if sealed, err = db.encryptData(data); err != nil {
+			return err
+		}
+		entry.Data = base64.StdEncoding.EncodeToString([]byte(sealed))
+		entry.Sealed = true
+	}
+
+	if buf, err = json.Marshal(entry); err != nil {
+		return err
+	}
+
+	t.send("HSET", db.genRevisionHashKey(id), id, entry.Rev)
+	t.send("LPUSH", k, buf)
+	t.send("LTRIM", k, 0, db.maxRevisions-1)
+	return nil
+}
+
+// History returns the revisions of the record. The newest revision comes first.
+// History of deleted records is kept.
+func (db *DB) History(id string) (revisions []Revision, err error) {
+	var nID uint64
+	var items [][]byte
+	var entry revisionEntry
+	var sealed []byte
+
+	revisions = []Revision{}
+
+	if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		goto end
+	}
+
+	if items, err = redis.ByteSlices(db.c.Do("LRANGE", db.genHistoryKey(nID), 0, -1)); err != nil {
+		goto end
+	}
+
+	for _, item := range items {
+		entry = revisionEntry{}
+		if err = json.Unmarshal(item, &entry); err != nil {
+			goto end
+		}
+
+		if entry.Sealed {
+			if sealed, err = base64.StdEncoding.DecodeString(entry.Data); err != nil {
+				goto end
+			}
+
+			if entry.Data, err = db.decryptData(string(sealed)); err != nil {
+				goto end
+			}
+		}
+		revisions = append(revisions, Revision{Rev: entry.Rev, Time: time.UnixMilli(entry.Time), Data: entry.Data})
+	}
+
+end:
+	if err != nil {
+		debugPrintf("History() error: %v\n", err)
+		return []Revision{}, err
+	}
+
+	return revisions, nil
+}
+
+// GetRevision returns the revision of the record by given revision number.
+func (db *DB) GetRevision(id string, rev uint64) (revision Revision, err error) {
+	revisions := []Revision{}
+
+	if revisions, err = db.History(id); err != nil {
+		goto end
+	}
+
+	for _, r := range revisions {
+		if r.Rev == rev {
+			return r, nil
+		}
+	}
+
+	err = fmt.Errorf("Revision %v of id: %v does not exist.", rev, id)
+
+end:
+	if err != nil {
+		debugPrintf("GetRevision() error: %v\n", err)
+		return Revision{}, err
+	}
+
+	return revision, nil
+}
+
+// Revert replaces the data of the record with the data of given revision.
+// The record is created again with the same id if it's deleted.
+// Current data is appended to the history as a new revision.
+func (db *DB) Revert(id string, rev uint64) (err error) {
+	revision := Revision{}
+
+	if revision, err = db.GetRevision(id, rev); err != nil {
+		goto end
+	}
+
+	if _, err = db.upsert(OpRevert, []Record{{ID: id, Data: revision.Data}}); err != nil {
+		goto end
+	}
+
+	debugPrintf("Revert() ok. id: %v, rev: %v\n", id, rev)
+
+end:
+	if err != nil {
+		debugPrintf("Revert() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
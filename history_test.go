@@ -0,0 +1,82 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_History() {
+	var err error
+	var db *simpledb.DB
+	id := ""
+	record := simpledb.Record{}
+	revisions := []simpledb.Revision{}
+
+	log.Printf("\n")
+	log.Printf("--------- History() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "history-test")
+	defer db.Close()
+
+	// Keep at most 10 revisions for each record.
+	db.SetHistory(10)
+
+	if id, err = db.Create(`{"name":"Quinn","tel":"13900139061"}`); err != nil {
+		goto end
+	}
+
+	if err = db.Update(simpledb.Record{ID: id, Data: `{"name":"Quinn","tel":"18900189061"}`}); err != nil {
+		goto end
+	}
+
+	if err = db.Update(simpledb.Record{ID: id, Data: `{"name":"Quinn","tel":"18600186061"}`}); err != nil {
+		goto end
+	}
+
+	if revisions, err = db.History(id); err != nil {
+		goto end
+	}
+
+	for _, r := range revisions {
+		log.Printf("rev: %v, time: %v, data: %v\n", r.Rev, r.Time, r.Data)
+	}
+
+	// Revert to the first revision.
+	if err = db.Revert(id, 1); err != nil {
+		goto end
+	}
+
+	if record, err = db.Get(id); err != nil {
+		goto end
+	}
+	log.Printf("reverted: id: %v, data: %v\n", record.ID, record.Data)
+
+	// Revision numbers keep increasing after the record is deleted and created again by Revert().
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	if err = db.Revert(id, 2); err != nil {
+		goto end
+	}
+
+	if revisions, err = db.History(id); err != nil {
+		goto end
+	}
+
+	for _, r := range revisions {
+		log.Printf("rev: %v, time: %v, data: %v\n", r.Rev, r.Time, r.Data)
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- History() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,375 @@
+package simpledb
+
+import (
+	"context"
+	"time"
+)
+
+// Operation is the operation passed to hooks.
+type Operation string
+
+const (
+	// OpCreate is the operation of Create().
+	OpCreate Operation = "create"
+	// OpBatchCreate is the operation of BatchCreate().
+	OpBatchCreate Operation = "batch-create"
+	// OpGet is the operation of Get().
+	OpGet Operation = "get"
+	// OpBatchGet is the operation of BatchGet().
+	OpBatchGet Operation = "batch-get"
+	// OpUpdate is the operation of Update().
+	OpUpdate Operation = "update"
+	// OpBatchUpdate is the operation of BatchUpdate().
+	OpBatchUpdate Operation = "batch-update"
+	// OpDelete is the operation of Delete().
+	OpDelete Operation = "delete"
+	// OpBatchDelete is the operation of BatchDelete().
+	OpBatchDelete Operation = "batch-delete"
+	// OpSearch is the operation of Search().
+	OpSearch Operation = "search"
+	// OpRegexpSearch is the operation of RegexpSearch().
+	OpRegexpSearch Operation = "regexp-search"
+	// OpTextSearch is the operation of TextSearch().
+	OpTextSearch Operation = "text-search"
+	// OpFind is the operation of Find().
+	OpFind Operation = "find"
+	// OpPrefixSearch is the operation of PrefixSearch().
+	OpPrefixSearch Operation = "prefix-search"
+	// OpRangeSearch is the operation of RangeSearch().
+	OpRangeSearch Operation = "range-search"
+	// OpAggregate is the operation of Aggregate().
+	OpAggregate Operation = "aggregate"
+	// OpBatchCreatePartial is the operation of BatchCreatePartial().
+	OpBatchCreatePartial Operation = "batch-create-partial"
+	// OpBatchUpdatePartial is the operation of BatchUpdatePartial().
+	OpBatchUpdatePartial Operation = "batch-update-partial"
+	// OpBatchDeletePartial is the operation of BatchDeletePartial().
+	OpBatchDeletePartial Operation = "batch-delete-partial"
+	// OpUpsert is the operation of Upsert().
+	OpUpsert Operation = "upsert"
+	// OpBatchUpsert is the operation of BatchUpsert().
+	OpBatchUpsert Operation = "batch-upsert"
+	// OpCreateOrGet is the operation of CreateOrGet().
+	OpCreateOrGet Operation = "create-or-get"
+	// OpBatchCreateOrGet is the operation of BatchCreateOrGet().
+	OpBatchCreateOrGet Operation = "batch-create-or-get"
+	// OpRestore is the operation of Restore().
+	OpRestore Operation = "restore"
+	// OpBatchRestore is the operation of BatchRestore().
+	OpBatchRestore Operation = "batch-restore"
+	// OpRevert is the operation of Revert().
+	OpRevert Operation = "revert"
+	// OpReapExpired is the operation of deleting expired records by ReapExpired().
+	OpReapExpired Operation = "reap-expired"
+)
+
+// IsWrite reports whether the operation writes records.
+// Hooks which veto or audit writes should check it instead of listing the operations.
+func (op Operation) IsWrite() bool {
+	switch op {
+	case OpGet, OpBatchGet, OpSearch, OpRegexpSearch, OpTextSearch, OpFind, OpPrefixSearch, OpRangeSearch, OpAggregate:
+		return false
+	}
+	return true
+}
+
+// HookContext contains the operation, records and results passed to hooks.
+type HookContext struct {
+	// Context is the context of the operation. It's the context set by WithContext() or context.Background().
+	Context context.Context
+	// DB is the database.
+	DB *DB
+	// Op is the operation.
+	Op Operation
+	// Records are the input records. Before hooks can modify them.
+	//     Create / BatchCreate / BatchCreatePartial / CreateOrGet / BatchCreateOrGet: records to create.
+	//         IDs are empty unless they're supplied by CreateWithID / BatchCreateWithIDs.
+	//     Get / BatchGet / Delete / BatchDelete / BatchDeletePartial / Restore / BatchRestore / ReapExpired: IDs of records. Data are empty.
+	//     Update / BatchUpdate / BatchUpdatePartial / Upsert / BatchUpsert: records to update or upsert.
+	//         UpdateIfVersion / UpdateIfData use Update.
+	//     Revert: the record with the data of the revision.
+	//     Aggregate: IDs of records to aggregate. It's nil if all records are aggregated.
+	//     Search / RegexpSearch / TextSearch / Find / PrefixSearch / RangeSearch: empty.
+	Records []Record
+	// Patterns are the search patterns of Search / RegexpSearch or the query of TextSearch. Before hooks can modify them.
+	//     PrefixSearch: the field and the prefix.
+	//     RangeSearch: the field, min and max.
+	Patterns []string
+	// Query is the query of Find. Before hooks can modify it.
+	Query *Query
+	// Results are the records of the operation. They're set before after hooks are called.
+	//     Create / BatchCreate / BatchCreatePartial: created records.
+	//     CreateOrGet / BatchCreateOrGet: created or found records.
+	//     Get / BatchGet: records with data.
+	//     Update / BatchUpdate / BatchUpdatePartial / Upsert / BatchUpsert / Revert: updated or created records.
+	//     Delete / BatchDelete / BatchDeletePartial / ReapExpired: IDs of deleted records.
+	//     Restore / BatchRestore: IDs of restored records.
+	//     Search / TextSearch / Find / PrefixSearch / RangeSearch: IDs of matched records.
+	//     RegexpSearch: IDs of matched records of all patterns.
+	//     Aggregate: empty. The result is returned by Aggregate.
+	Results []Record
+	// Err is the error of the operation. It's set before after hooks are called.
+	Err error
+	// Values stores values shared by hooks in the same operation.
+	Values map[string]interface{}
+}
+
+// Hook is called around operations.
+type Hook struct {
+	// Before is called before the operation. It can modify the records or patterns in hc,
+	// or return an error to veto the operation. The error is returned by the operation.
+	// It's optional.
+	Before func(hc *HookContext) error
+	// After is called after the operation to observe the results and error. It's optional.
+	After func(hc *HookContext)
+}
+
+// Use appends hooks to the hook chain of the DB.
+// Before hooks are called in the order they're added and after hooks are called in the reverse order.
+// Hooks are called by Create, CreateWithID, CreateWithTTL, Get, Update, UpdateIfVersion, UpdateIfData, Delete, Upsert, CreateOrGet,
+// Restore, Revert, ReapExpired, Search, RegexpSearch, TextSearch, Find, PrefixSearch, RangeSearch, Aggregate,
+// and their batch, partial and WithOptions forms.
+// Maintenance operations(Ex: Truncate(), PurgeTrash(), Compact() and catalog operations) do not call hooks.
+func (db *DB) Use(hooks ...Hook) {
+	db.hooks = append(db.hooks, hooks...)
+}
+
+// WithContext returns a shallow copy of the DB which passes ctx to hooks.
+// The copy shares the Redis connection with db and should be used in the same goroutine.
+func (db *DB) WithContext(ctx context.Context) *DB {
+	newDB := &DB{}
+	*newDB = *db
+	newDB.ctx = ctx
+	return newDB
+}
+
+// newHookContext creates a hook context for the operation.
+func (db *DB) newHookContext(op Operation, records []Record, patterns []string) *HookContext {
+	ctx := db.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return &HookContext{
+		Context:  ctx,
+		DB:       db,
+		Op:       op,
+		Records:  records,
+		Patterns: patterns,
+		Values:   make(map[string]interface{}),
+	}
+}
+
+// runHooks calls before hooks, fn and after hooks.
+// If a before hook returns an error, fn is not called and only after hooks of the hooks called before are called.
+func (db *DB) runHooks(hc *HookContext, fn func() error) error {
+	called := 0
+
+	for _, h := range db.hooks {
+		if h.Before != nil {
+			if hc.Err = h.Before(hc); hc.Err != nil {
+				break
+			}
+		}
+		called++
+	}
+
+	if hc.Err == nil {
+		hc.Err = fn()
+	}
+
+	for i := called - 1; i >= 0; i-- {
+		if db.hooks[i].After != nil {
+			db.hooks[i].After(hc)
+		}
+	}
+	return hc.Err
+}
+
+// dataRecords converts the data array to records with empty IDs.
+func dataRecords(dataArr []string) []Record {
+	records := []Record{}
+	for _, data := range dataArr {
+		records = append(records, Record{Data: data})
+	}
+	return records
+}
+
+// idRecords converts the ids to records with empty data.
+func idRecords(ids []string) []Record {
+	records := []Record{}
+	for _, id := range ids {
+		records = append(records, Record{ID: id})
+	}
+	return records
+}
+
+// resultIDs returns the ids of committed items.
+func resultIDs(results []ItemResult) []string {
+	ids := []string{}
+	for _, r := range results {
+		if r.Status == ItemCommitted {
+			ids = append(ids, r.ID)
+		}
+	}
+	return ids
+}
+
+// recordIDs returns the ids of the records.
+func recordIDs(records []Record) []string {
+	ids := []string{}
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+// create creates records in one transaction with hooks of op.
+// Items which fail the checks are skipped if skipFailed is true. Records expire after ttl if it's greater than 0.
+func (db *DB) create(op Operation, records []Record, skipFailed bool, ttl time.Duration) (results []ItemResult, err error) {
+	hc := db.newHookContext(op, append([]Record{}, records...), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		if results, err = db.batchCreate(hc.Records, skipFailed, ttl); err != nil {
+			return err
+		}
+
+		for i, r := range results {
+			if r.Status == ItemCommitted {
+				hc.Results = append(hc.Results, Record{ID: r.ID, Data: hc.Records[i].Data})
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return []ItemResult{}, err
+	}
+	return results, nil
+}
+
+// get gets records with hooks of op.
+func (db *DB) get(op Operation, ids []string) (records []Record, err error) {
+	hc := db.newHookContext(op, idRecords(ids), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		hc.Results, err = db.batchGet(recordIDs(hc.Records))
+		return err
+	})
+
+	if err != nil {
+		return []Record{}, err
+	}
+	return hc.Results, nil
+}
+
+// update updates records in one transaction with hooks of op.
+// Items which fail the checks or cond(optional) are skipped if skipFailed is true.
+func (db *DB) update(op Operation, records []Record, skipFailed bool, cond updateCond) (results []ItemResult, err error) {
+	hc := db.newHookContext(op, append([]Record{}, records...), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		if results, err = db.batchUpdate(hc.Records, skipFailed, cond); err != nil {
+			return err
+		}
+
+		for i, r := range results {
+			if r.Status != ItemSkipped {
+				hc.Results = append(hc.Results, hc.Records[i])
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return []ItemResult{}, err
+	}
+	return results, nil
+}
+
+// delete deletes records in one transaction with hooks of op.
+// Items which fail the checks or cond(optional) are skipped if skipFailed is true.
+// Deleted records are moved to the trash if soft is true.
+func (db *DB) delete(op Operation, ids []string, skipFailed, soft bool, cond deleteCond) (results []ItemResult, err error) {
+	hc := db.newHookContext(op, idRecords(ids), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		if results, err = db.batchDelete(recordIDs(hc.Records), skipFailed, soft, cond); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(resultIDs(results))
+		return nil
+	})
+
+	if err != nil {
+		return []ItemResult{}, err
+	}
+	return results, nil
+}
+
+// upsert creates or replaces records in one transaction with hooks of op.
+func (db *DB) upsert(op Operation, records []Record) (results []UpsertResult, err error) {
+	hc := db.newHookContext(op, append([]Record{}, records...), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		if results, err = db.batchUpsert(hc.Records); err != nil {
+			return err
+		}
+
+		hc.Results = hc.Records
+		return nil
+	})
+
+	if err != nil {
+		return []UpsertResult{}, err
+	}
+	return results, nil
+}
+
+// createOrGet creates records or gets the IDs of existing records in one transaction with hooks of op.
+func (db *DB) createOrGet(op Operation, dataArr []string) (results []UpsertResult, err error) {
+	hc := db.newHookContext(op, dataRecords(dataArr), nil)
+
+	err = db.runHooks(hc, func() error {
+		var err error
+		dataArr := []string{}
+		for _, r := range hc.Records {
+			dataArr = append(dataArr, r.Data)
+		}
+
+		if results, err = db.batchCreateOrGet(dataArr); err != nil {
+			return err
+		}
+
+		for i, r := range results {
+			hc.Results = append(hc.Results, Record{ID: r.ID, Data: dataArr[i]})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return []UpsertResult{}, err
+	}
+	return results, nil
+}
+
+// restore restores records from the trash in one transaction with hooks of op.
+func (db *DB) restore(op Operation, ids []string) (err error) {
+	hc := db.newHookContext(op, idRecords(ids), nil)
+
+	return db.runHooks(hc, func() error {
+		ids := recordIDs(hc.Records)
+		if err := db.batchRestore(ids); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	})
+}
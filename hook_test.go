@@ -0,0 +1,141 @@
+package simpledb_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Use() {
+	var err error
+	var db *simpledb.DB
+	var id string
+	var r simpledb.Record
+
+	log.Printf("\n")
+	log.Printf("--------- Use() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "hook-test")
+	defer db.Close()
+
+	db.Use(
+		// Audit hook: log all operations.
+		simpledb.Hook{
+			After: func(hc *simpledb.HookContext) {
+				log.Printf("audit: op: %v, results: %v, err: %v\n", hc.Op, hc.Results, hc.Err)
+			},
+		},
+		// Normalize data before writing and veto records without name.
+		simpledb.Hook{
+			Before: func(hc *simpledb.HookContext) error {
+				switch hc.Op {
+				case simpledb.OpCreate, simpledb.OpBatchCreate, simpledb.OpUpdate, simpledb.OpBatchUpdate:
+					for i := range hc.Records {
+						hc.Records[i].Data = strings.TrimSpace(hc.Records[i].Data)
+						if !strings.Contains(hc.Records[i].Data, `"name"`) {
+							return fmt.Errorf("Record %v has no name.", i)
+						}
+					}
+				}
+				return nil
+			},
+		},
+	)
+
+	if id, err = db.Create(`  {"name":"Grace","tel":"13700137301"}  `); err != nil {
+		goto end
+	}
+
+	if r, err = db.Get(id); err != nil {
+		goto end
+	}
+	log.Printf("record: %v\n", r)
+
+	if _, err = db.Create(`{"tel":"13700137302"}`); err != nil {
+		log.Printf("vetoed: %v\n", err)
+		err = nil
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Use() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_Use_veto() {
+	var err error
+	var db *simpledb.DB
+	var id string
+	var version uint64
+	readOnly := fmt.Errorf("Database is read-only.")
+
+	log.Printf("\n")
+	log.Printf("--------- Use() Veto Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "hook-veto-test")
+	defer db.Close()
+
+	if id, err = db.Create(`{"name":"Ivy","tel":"13700137303"}`); err != nil {
+		goto end
+	}
+
+	// Veto all writes. Batch, partial, conditional and upsert forms are vetoed too.
+	db.Use(simpledb.Hook{
+		Before: func(hc *simpledb.HookContext) error {
+			if hc.Op.IsWrite() {
+				return readOnly
+			}
+			return nil
+		},
+	})
+
+	if _, err = db.BatchCreatePartial([]string{`{"name":"Jim"}`}); err == readOnly {
+		log.Printf("BatchCreatePartial() vetoed: %v\n", err)
+	}
+
+	if _, err = db.BatchUpsert([]simpledb.Record{{ID: id, Data: `{"name":"Ivy","tel":"13700137304"}`}}); err == readOnly {
+		log.Printf("BatchUpsert() vetoed: %v\n", err)
+	}
+
+	if version, err = db.GetVersion(id); err != nil {
+		goto end
+	}
+
+	if err = db.UpdateIfVersion(id, `{"name":"Ivy","tel":"13700137305"}`, version); err == readOnly {
+		log.Printf("UpdateIfVersion() vetoed: %v\n", err)
+	}
+
+	if err = db.UpdateIfData(id, `{"name":"Ivy","tel":"13700137303"}`, `{"name":"Ivy","tel":"13700137306"}`); err == readOnly {
+		log.Printf("UpdateIfData() vetoed: %v\n", err)
+	}
+
+	if _, err = db.BatchDeletePartial([]string{id}); err == readOnly {
+		log.Printf("BatchDeletePartial() vetoed: %v\n", err)
+	}
+	err = nil
+
+	// Clean up by a new DB instance without hooks.
+	if db, err = simpledb.Open(":6379", "", "hook-veto-test"); err != nil {
+		goto end
+	}
+	defer db.Close()
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Use() Veto Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,395 @@
+package simpledb
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// BucketMappingSequential maps record IDs to buckets by range: bucket id = record id / hash-max-ziplist-entries + 1.
+	// It's used for sequential IDs.
+	BucketMappingSequential = "sequential"
+	// BucketMappingHashed maps record IDs to buckets by hash: bucket id = CRC32(record id) % estimated bucket number + 1.
+	// It's used for non-sequential IDs so that records still pack into ziplist-sized buckets.
+	BucketMappingHashed = "hashed"
+)
+
+const (
+	// MaxIDGap is the max gap between a client-supplied ID and the max record ID in sequential bucket mapping.
+	// Larger IDs would create too many empty buckets which are walked by Count(), Info() and scans of records.
+	// Use an ID generator of hashed bucket mapping(see SetIDGenerator()) for non-sequential IDs.
+	MaxIDGap uint64 = EstimatedMaxRecordNum
+)
+
+// Kinds of ID generators stored in the meta data. Other generators are stored by their type names(Ex: "*main.MyGenerator").
+const (
+	idGeneratorSequential = "sequential"
+	idGeneratorTime       = "time"
+	idGeneratorClient     = "client"
+)
+
+var (
+	// ErrIDRequired is returned when creating records without IDs while the ID generator is ClientIDGenerator.
+	ErrIDRequired = errors.New("Record ID should be supplied by client.")
+)
+
+// IDGenerator generates IDs of new records.
+type IDGenerator interface {
+	// NextID returns a new record ID which should be greater than 0.
+	// maxID is the max record ID of the database in the transaction.
+	NextID(maxID uint64) (id uint64, err error)
+	// Sequential reports whether IDs are generated sequentially from 1.
+	// Records of non-sequential IDs are distributed to buckets by hash(see BucketMappingHashed).
+	Sequential() bool
+}
+
+// SequentialIDGenerator generates sequential IDs: max ID + 1. It's the default ID generator.
+type SequentialIDGenerator struct{}
+
+// NextID returns maxID + 1.
+func (g SequentialIDGenerator) NextID(maxID uint64) (id uint64, err error) {
+	return maxID + 1, nil
+}
+
+// Sequential returns true.
+func (g SequentialIDGenerator) Sequential() bool {
+	return true
+}
+
+const (
+	// timeIDNodeBits is the number of bits of node ID in time-ordered IDs.
+	timeIDNodeBits = 10
+	// timeIDSeqBits is the number of bits of sequence number in time-ordered IDs.
+	timeIDSeqBits = 12
+	// MaxTimeIDNode is the max node ID of TimeIDGenerator.
+	MaxTimeIDNode = 1<<timeIDNodeBits - 1
+)
+
+var (
+	// TimeIDEpoch is the epoch of time-ordered IDs.
+	TimeIDEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// TimeIDGenerator generates time-ordered IDs in snowflake style.
+//
+//	ID layout(63 bits):
+//	    41 bits: milliseconds since TimeIDEpoch.
+//	    10 bits: node ID. Each process which creates records should use a different node ID.
+//	    12 bits: sequence number in the same millisecond.
+type TimeIDGenerator struct {
+	node   uint64
+	mu     sync.Mutex
+	lastMs int64
+	seq    uint64
+}
+
+// NewTimeIDGenerator returns a time-ordered ID generator.
+//
+//	Params:
+//	    node: node ID from 0 to MaxTimeIDNode.
+func NewTimeIDGenerator(node uint64) (g *TimeIDGenerator, err error) {
+	if node > MaxTimeIDNode {
+		err = fmt.Errorf("Node ID should be <= %v.", MaxTimeIDNode)
+		debugPrintf("NewTimeIDGenerator() error: %v\n", err)
+		return nil, err
+	}
+
+	return &TimeIDGenerator{node: node}, nil
+}
+
+// NextID returns a new time-ordered ID. maxID is not used.
+func (g *TimeIDGenerator) NextID(maxID uint64) (id uint64, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Since(TimeIDEpoch).Milliseconds()
+	// Do not go back if the clock goes backwards.
+	if ms < g.lastMs {
+		ms = g.lastMs
+	}
+
+	if ms == g.lastMs {
+		g.seq = (g.seq + 1) & (1<<timeIDSeqBits - 1)
+		// Sequence number overflows: wait for next millisecond.
+		if g.seq == 0 {
+			for ms <= g.lastMs {
+				time.Sleep(time.Millisecond)
+				ms = time.Since(TimeIDEpoch).Milliseconds()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMs = ms
+
+	return uint64(ms)<<(timeIDNodeBits+timeIDSeqBits) | g.node<<timeIDSeqBits | g.seq, nil
+}
+
+// Sequential returns false.
+func (g *TimeIDGenerator) Sequential() bool {
+	return false
+}
+
+// ClientIDGenerator does not generate IDs. Record IDs should be supplied by CreateWithID() or BatchCreateWithIDs().
+type ClientIDGenerator struct{}
+
+// NextID returns ErrIDRequired.
+func (g ClientIDGenerator) NextID(maxID uint64) (id uint64, err error) {
+	return 0, ErrIDRequired
+}
+
+// Sequential returns false.
+func (g ClientIDGenerator) Sequential() bool {
+	return false
+}
+
+// idGeneratorKind returns the kind of the ID generator stored in the meta data. It's "sequential" if g is nil.
+func idGeneratorKind(g IDGenerator) string {
+	switch g.(type) {
+	case nil, SequentialIDGenerator, *SequentialIDGenerator:
+		return idGeneratorSequential
+	case *TimeIDGenerator:
+		return idGeneratorTime
+	case ClientIDGenerator, *ClientIDGenerator:
+		return idGeneratorClient
+	}
+	return fmt.Sprintf("%T", g)
+}
+
+// SetIDGenerator sets the ID generator of new records.
+// The bucket mapping of the database(see BucketMappingSequential and BucketMappingHashed) is decided by the generator.
+// Both the bucket mapping and the kind of the generator(sequential, time, client or the type name of other generators)
+// are stored in the meta data. They can only be changed when the database is empty.
+// Open() reads the stored kind, and records can not be created with generated IDs until the same kind of generator is set.
+// All clients should use the same kind of generator and reopen the database after the generator is changed.
+func (db *DB) SetIDGenerator(g IDGenerator) (err error) {
+	mapping := BucketMappingSequential
+	kind := idGeneratorKind(g)
+
+	if g == nil {
+		err = fmt.Errorf("Nil ID generator.")
+		goto end
+	}
+
+	if !g.Sequential() {
+		mapping = BucketMappingHashed
+	}
+
+	if _, err = db.doTx([]string{db.genMetaKey()}, func(t *tx) error {
+		var maxID uint64
+		var current, currentKind string
+		var err error
+
+		if current, err = db.getBucketMapping(); err != nil {
+			return err
+		}
+
+		if currentKind, err = db.getIDGeneratorKind(); err != nil {
+			return err
+		}
+
+		// The kind is unknown for databases of hashed bucket mapping created by older versions.
+		if current == mapping && (currentKind == kind || len(currentKind) == 0) {
+			if currentKind != kind {
+				t.send("HSET", db.genMetaKey(), metaFieldIDGenerator, kind)
+			}
+			return nil
+		}
+
+		if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
+			return err
+		}
+
+		if maxID > 0 {
+			if current != mapping {
+				return fmt.Errorf("Bucket mapping can not be changed from %v to %v: database is not empty.", current, mapping)
+			}
+			return fmt.Errorf("ID generator can not be changed from %v to %v: database is not empty.", currentKind, kind)
+		}
+
+		t.send("HSET", db.genMetaKey(), metaFieldBucketMapping, mapping)
+		t.send("HSET", db.genMetaKey(), metaFieldIDGenerator, kind)
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+	db.idGenerator = g
+	db.hashedBuckets = mapping == BucketMappingHashed
+	db.storedIDGenerator = kind
+
+end:
+	if err != nil {
+		debugPrintf("SetIDGenerator() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// getBucketMapping gets the bucket mapping stored in the meta data. It returns BucketMappingSequential if it's not set.
+func (db *DB) getBucketMapping() (mapping string, err error) {
+	if mapping, err = redis.String(db.c.Do("HGET", db.genMetaKey(), metaFieldBucketMapping)); err != nil {
+		if err == redis.ErrNil {
+			return BucketMappingSequential, nil
+		}
+		return "", err
+	}
+	return mapping, nil
+}
+
+// getIDGeneratorKind gets the kind of the ID generator stored in the meta data.
+// If it's not set, it returns "sequential" for sequential bucket mapping,
+// or empty string for databases of hashed bucket mapping created by older versions.
+func (db *DB) getIDGeneratorKind() (kind string, err error) {
+	var mapping string
+
+	if kind, err = redis.String(db.c.Do("HGET", db.genMetaKey(), metaFieldIDGenerator)); err != nil {
+		if err != redis.ErrNil {
+			return "", err
+		}
+
+		if mapping, err = db.getBucketMapping(); err != nil {
+			return "", err
+		}
+
+		if mapping == BucketMappingSequential {
+			return idGeneratorSequential, nil
+		}
+		return "", nil
+	}
+	return kind, nil
+}
+
+// computeHashedBucketID returns the record bucket id by hash of given record id.
+func (db *DB) computeHashedBucketID(id uint64) uint64 {
+	return uint64(crc32.ChecksumIEEE([]byte(strconv.FormatUint(id, 10))))%db.estRecordBucketNum + 1
+}
+
+// checkIDGap returns an error if the client-supplied ID is greater than maxID + MaxIDGap in sequential bucket mapping.
+func (db *DB) checkIDGap(id, maxID uint64) error {
+	if db.hashedBuckets || id <= maxID+MaxIDGap {
+		return nil
+	}
+	return fmt.Errorf("Id: %v is greater than max id(%v) + MaxIDGap(%v). Use hashed bucket mapping for non-sequential IDs.", id, maxID, MaxIDGap)
+}
+
+// nextID returns the ID of a new record in the transaction.
+//
+//	Params:
+//	    id: client-supplied ID. The ID is generated by the ID generator if it's empty.
+//	    maxID: max record ID. It's updated if the new ID is greater.
+//	    usedIDs: IDs of the new records in the same transaction.
+//	Returns:
+//	    nID: new record ID.
+//	    itemErr: error of the item. Ex: invalid or existing ID.
+//	    err: error which aborts the transaction.
+func (db *DB) nextID(id string, maxID *uint64, usedIDs map[uint64]struct{}) (nID uint64, itemErr, err error) {
+	var exists, ok bool
+	g := db.idGenerator
+
+	if g == nil {
+		g = SequentialIDGenerator{}
+	}
+
+	if len(id) == 0 {
+		// Generated IDs of other kinds of generators may collide or break the order of IDs.
+		if kind := idGeneratorKind(db.idGenerator); len(db.storedIDGenerator) != 0 && kind != db.storedIDGenerator {
+			return 0, nil, fmt.Errorf("ID generator is %v but the database uses %v. Call SetIDGenerator() first.", kind, db.storedIDGenerator)
+		}
+
+		if nID, err = g.NextID(*maxID); err != nil {
+			if err == ErrIDRequired {
+				return 0, err, nil
+			}
+			return 0, nil, err
+		}
+	} else {
+		if nID, itemErr = strconv.ParseUint(id, 10, 64); itemErr == nil && nID == 0 {
+			itemErr = fmt.Errorf("Invalid id: %v.", id)
+		}
+
+		if itemErr == nil {
+			itemErr = db.checkIDGap(nID, *maxID)
+		}
+
+		if itemErr != nil {
+			return 0, itemErr, nil
+		}
+	}
+
+	// Sequential IDs greater than max ID are always new.
+	// Other IDs may be supplied by client or generated by other processes, check them.
+	if len(id) != 0 || !g.Sequential() {
+		if _, ok = usedIDs[nID]; ok {
+			return 0, fmt.Errorf("Redundant id: %v.", nID), nil
+		}
+
+		if err = db.watch(db.genRecordHashKey(nID)); err != nil {
+			return 0, nil, err
+		}
+
+		if _, exists, err = db.getRecordData(nID); err != nil {
+			return 0, nil, err
+		}
+
+		if exists {
+			return 0, fmt.Errorf("Id: %v already exists.", nID), nil
+		}
+	}
+
+	usedIDs[nID] = struct{}{}
+	if nID > *maxID {
+		*maxID = nID
+	}
+	return nID, nil, nil
+}
+
+// CreateWithID creates a new record with client-supplied ID. It fails if the ID already exists,
+// or it's greater than max id + MaxIDGap in sequential bucket mapping.
+func (db *DB) CreateWithID(record Record) (err error) {
+	if len(record.ID) == 0 {
+		err = fmt.Errorf("Empty id.")
+		debugPrintf("CreateWithID() error: %v\n", err)
+		return err
+	}
+
+	if _, err = db.create(OpCreate, []Record{record}, false, 0); err != nil {
+		debugPrintf("CreateWithID() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// BatchCreateWithIDs creates records with client-supplied IDs in one transaction.
+// It fails if any ID is invalid or already exists, or any data is empty, redundant, invalid or already exists.
+// IDs should be positive integers, and not greater than max id + MaxIDGap in sequential bucket mapping.
+func (db *DB) BatchCreateWithIDs(records []Record) (err error) {
+	for _, r := range records {
+		if len(r.ID) == 0 {
+			err = fmt.Errorf("Empty id.")
+			goto end
+		}
+	}
+
+	if _, err = db.create(OpBatchCreate, records, false, 0); err != nil {
+		goto end
+	}
+
+	debugPrintf("BatchCreateWithIDs() ok. records: %v\n", records)
+
+end:
+	if err != nil {
+		debugPrintf("BatchCreateWithIDs() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetIDGenerator() {
+	var err error
+	var db, db2 *simpledb.DB
+	var g *simpledb.TimeIDGenerator
+	var ids []string
+	var infoMap map[string]string
+
+	log.Printf("\n")
+	log.Printf("--------- SetIDGenerator() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "idgen-test")
+	defer db.Close()
+
+	// Bucket mapping can only be changed when the database is empty.
+	if err = db.Truncate(); err != nil {
+		goto end
+	}
+
+	if g, err = simpledb.NewTimeIDGenerator(1); err != nil {
+		goto end
+	}
+
+	if err = db.SetIDGenerator(g); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Ivy","tel":"13600136401"}`,
+		`{"name":"Jack","tel":"13600136402"}`,
+	}); err != nil {
+		goto end
+	}
+	log.Printf("time-ordered ids: %v\n", ids)
+
+	// Create a record with client-supplied ID.
+	if err = db.CreateWithID(simpledb.Record{ID: "20240101", Data: `{"name":"Kate","tel":"13600136403"}`}); err != nil {
+		goto end
+	}
+
+	// The kind of the generator is stored in the meta data.
+	// Another handle can not create records with generated IDs until it sets the same kind of generator.
+	db2, _ = simpledb.Open(":6379", "", "idgen-test")
+	defer db2.Close()
+
+	if _, err = db2.Create(`{"name":"Lucy","tel":"13600136404"}`); err == nil {
+		log.Printf("Create() should fail without SetIDGenerator()\n")
+	}
+
+	if infoMap, err = db.Info(); err != nil {
+		goto end
+	}
+	log.Printf("bucket mapping: %v, max bucket id: %v\n", infoMap["bucket mapping"], infoMap["max bucket id"])
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetIDGenerator() Test End --------\n")
+	// Output:
+}
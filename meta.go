@@ -0,0 +1,222 @@
+package simpledb
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// LayoutVersion is the current version of the key layout in Redis.
+	// Open() upgrades databases of older layouts step by step.
+	//
+	//	Layout versions:
+	//	    0: meta data are stored in separate keys: "<name>/redis-hash-max-ziplist-entries", "<name>/maxid" and "<name>/maxbucketid".
+	//	    1: meta data are stored in one hash: "<name>/meta".
+	LayoutVersion uint64 = 1
+)
+
+// Fields of the meta hash.
+const (
+	metaFieldLayoutVersion              = "layout-version"
+	metaFieldRedisHashMaxZiplistEntries = "redis-hash-max-ziplist-entries"
+	metaFieldMaxID                      = "maxid"
+	metaFieldMaxBucketID                = "maxbucketid"
+	metaFieldBucketMapping              = "bucket-mapping"
+	metaFieldEncryption                 = "encryption"
+	metaFieldFieldIndexes               = "field-indexes"
+	metaFieldIDGenerator                = "id-generator"
+)
+
+// migration upgrades the key layout from version from to from + 1.
+type migration struct {
+	// from is the layout version to upgrade from.
+	from uint64
+	// description describes the changes of the layout.
+	description string
+	// migrate reads the data of the old layout and queues the commands to upgrade in the transaction.
+	// It should also set the layout version in the meta hash to from + 1.
+	migrate func(db *DB, t *tx) error
+}
+
+// migrations contains the migrations of all layout versions. migrations[i] upgrades layout version i to i + 1.
+var migrations = []migration{
+	{from: 0, description: "move separate meta keys to the meta hash", migrate: migrateV0ToV1},
+}
+
+// genMetaKey generates the key of the meta hash.
+func (db *DB) genMetaKey() string {
+	return fmt.Sprintf("%v/meta", db.name)
+}
+
+// genLegacyRedisHashMaxZiplistEntriesKey generates the "hash-max-ziplist-entries" key of layout version 0.
+func (db *DB) genLegacyRedisHashMaxZiplistEntriesKey() string {
+	return fmt.Sprintf("%v/redis-hash-max-ziplist-entries", db.name)
+}
+
+// genLegacyMaxIDKey generates the max record id key of layout version 0.
+func (db *DB) genLegacyMaxIDKey() string {
+	return fmt.Sprintf("%v/maxid", db.name)
+}
+
+// genLegacyMaxBucketIDKey generates the max record bucket id key of layout version 0.
+func (db *DB) genLegacyMaxBucketIDKey() string {
+	return fmt.Sprintf("%v/maxbucketid", db.name)
+}
+
+// legacyKeys returns the meta keys of layout version 0.
+func (db *DB) legacyKeys() []string {
+	return []string{
+		db.genLegacyRedisHashMaxZiplistEntriesKey(),
+		db.genLegacyMaxIDKey(),
+		db.genLegacyMaxBucketIDKey(),
+	}
+}
+
+// getMetaUint64 gets the uint64 value of given field in the meta hash. It returns defaultValue if the field does not exist.
+// It's used to read counters in a transaction without writing the watched meta hash.
+func (db *DB) getMetaUint64(field string, defaultValue uint64) (n uint64, err error) {
+	if n, err = redis.Uint64(db.c.Do("HGET", db.genMetaKey(), field)); err != nil {
+		if err == redis.ErrNil {
+			return defaultValue, nil
+		}
+		return 0, err
+	}
+	return n, nil
+}
+
+// getLayoutVersion gets the layout version of the database.
+// It returns false if the database is new(neither meta hash nor legacy meta keys exist).
+func (db *DB) getLayoutVersion() (version uint64, exists bool, err error) {
+	var n int
+
+	if version, err = redis.Uint64(db.c.Do("HGET", db.genMetaKey(), metaFieldLayoutVersion)); err == nil {
+		return version, true, nil
+	}
+
+	if err != redis.ErrNil {
+		return 0, false, err
+	}
+
+	// Meta hash does not exist. Check the legacy meta keys of layout version 0.
+	args := []interface{}{}
+	for _, k := range db.legacyKeys() {
+		args = append(args, k)
+	}
+
+	if n, err = redis.Int(db.c.Do("EXISTS", args...)); err != nil {
+		return 0, false, err
+	}
+
+	return 0, n > 0, nil
+}
+
+// queueInitMeta queues the commands to create the meta hash of a new database in the transaction.
+func (db *DB) queueInitMeta(t *tx) (err error) {
+	var redisHashMaxZiplistEntries uint64
+
+	if redisHashMaxZiplistEntries, err = GetRedisHashMaxZiplistEntries(db.c); err != nil {
+		return err
+	}
+
+	t.send("HSET", db.genMetaKey(),
+		metaFieldLayoutVersion, LayoutVersion,
+		metaFieldRedisHashMaxZiplistEntries, redisHashMaxZiplistEntries)
+	return nil
+}
+
+// migrateV0ToV1 moves the separate meta keys to the meta hash.
+func migrateV0ToV1(db *DB, t *tx) (err error) {
+	var redisHashMaxZiplistEntries, maxID, maxBucketID uint64
+
+	if redisHashMaxZiplistEntries, err = db.getUint64(db.genLegacyRedisHashMaxZiplistEntriesKey(), 0); err != nil {
+		return err
+	}
+
+	// Databases created by old versions always have the "hash-max-ziplist-entries" key.
+	// Read it from Redis config in case that it's lost.
+	if redisHashMaxZiplistEntries == 0 {
+		if redisHashMaxZiplistEntries, err = GetRedisHashMaxZiplistEntries(db.c); err != nil {
+			return err
+		}
+	}
+
+	if maxID, err = db.getUint64(db.genLegacyMaxIDKey(), 0); err != nil {
+		return err
+	}
+
+	if maxBucketID, err = db.getUint64(db.genLegacyMaxBucketIDKey(), 1); err != nil {
+		return err
+	}
+
+	t.send("HSET", db.genMetaKey(),
+		metaFieldLayoutVersion, 1,
+		metaFieldRedisHashMaxZiplistEntries, redisHashMaxZiplistEntries,
+		metaFieldMaxID, maxID,
+		metaFieldMaxBucketID, maxBucketID)
+	t.send("DEL", db.genLegacyRedisHashMaxZiplistEntriesKey(), db.genLegacyMaxIDKey(), db.genLegacyMaxBucketIDKey())
+	return nil
+}
+
+// upgradeMeta creates the meta hash for a new database or upgrades the layout of an existing database to LayoutVersion step by step.
+// Each step runs in one transaction so that concurrent Open() calls are safe.
+func (db *DB) upgradeMeta() (err error) {
+	keys := append([]string{db.genMetaKey()}, db.legacyKeys()...)
+	upgraded := false
+
+	for !upgraded {
+		if _, err = db.doTx(keys, func(t *tx) error {
+			version, exists, err := db.getLayoutVersion()
+			if err != nil {
+				return err
+			}
+
+			if !exists {
+				upgraded = true
+				return db.queueInitMeta(t)
+			}
+
+			if version > LayoutVersion {
+				return fmt.Errorf("Layout version %v is newer than supported version %v.", version, LayoutVersion)
+			}
+
+			if version == LayoutVersion {
+				upgraded = true
+				return nil
+			}
+
+			m := migrations[version]
+			debugPrintf("upgradeMeta(): db: %v, migrate layout version %v to %v: %v\n", db.name, m.from, m.from+1, m.description)
+			return m.migrate(db, t)
+		}); err != nil {
+			goto end
+		}
+	}
+
+	if db.redisHashMaxZiplistEntries, err = db.getMetaUint64(metaFieldRedisHashMaxZiplistEntries, 0); err != nil {
+		goto end
+	}
+
+	if db.redisHashMaxZiplistEntries == 0 {
+		err = fmt.Errorf("Invalid redis-hash-max-ziplist-entries in meta.")
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("upgradeMeta() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// GetLayoutVersion returns the key layout version of the database.
+func (db *DB) GetLayoutVersion() (version uint64, err error) {
+	if version, err = db.getMetaUint64(metaFieldLayoutVersion, 0); err != nil {
+		debugPrintf("GetLayoutVersion() error: %v\n", err)
+		return 0, err
+	}
+
+	return version, nil
+}
@@ -0,0 +1,59 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_GetLayoutVersion() {
+	var err error
+	var db *simpledb.DB
+	var c redis.Conn
+	var version, maxID uint64
+	name := "meta-test"
+
+	log.Printf("\n")
+	log.Printf("--------- GetLayoutVersion() Test Begin --------\n")
+
+	if c, err = simpledb.GetRedisConn(":6379", ""); err != nil {
+		goto end
+	}
+	defer c.Close()
+
+	// Make a database of layout version 0: meta data are stored in separate keys.
+	if err = simpledb.DropDB(c, name); err != nil {
+		goto end
+	}
+
+	c.Send("MULTI")
+	c.Send("SET", name+"/redis-hash-max-ziplist-entries", 512)
+	c.Send("SET", name+"/maxid", 3)
+	c.Send("SET", name+"/maxbucketid", 1)
+	if _, err = c.Do("EXEC"); err != nil {
+		goto end
+	}
+
+	// Open() upgrades the layout.
+	if db, err = simpledb.Open(":6379", "", name); err != nil {
+		goto end
+	}
+	defer db.Close()
+
+	if version, err = db.GetLayoutVersion(); err != nil {
+		goto end
+	}
+
+	if maxID, err = db.GetMaxID(); err != nil {
+		goto end
+	}
+	log.Printf("layout version: %v, max id: %v\n", version, maxID)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- GetLayoutVersion() Test End --------\n")
+	// Output:
+}
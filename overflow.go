@@ -0,0 +1,182 @@
+package simpledb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// encodedOverflow is the codec byte of references to overflow keys.
+	// Format: NUL, 'o', path of the overflow key without "<name>/" so that RenameDB() keeps it valid.
+	encodedOverflow byte = 'o'
+)
+
+// OversizePolicy decides how to store record data whose stored value is longer than "hash-max-ziplist-value".
+// Redis converts the bucket to "hashtable" encoding which uses much more memory if any value is too long.
+type OversizePolicy int
+
+const (
+	// OversizeAllow stores oversize data in buckets as usual. It's the default policy.
+	OversizeAllow OversizePolicy = iota
+	// OversizeReject rejects oversize data with *DataTooLargeError on every write path,
+	// including restoring records from the trash and moving deleted records to the trash.
+	OversizeReject
+	// OversizeOverflow stores oversize data in separate overflow keys(Ex: "student/overflow/3") referenced from the buckets.
+	OversizeOverflow
+)
+
+// DataTooLargeError is returned when the stored value of record data is longer than "hash-max-ziplist-value" in OversizeReject mode.
+type DataTooLargeError struct {
+	// Index is the order of the data in the batch.
+	Index int
+	// Size is the length of the value to store(after compression and encryption).
+	Size uint64
+	// Limit is "hash-max-ziplist-value" of Redis.
+	Limit uint64
+}
+
+// Error returns the error message.
+func (e *DataTooLargeError) Error() string {
+	return fmt.Sprintf("Data of item %v is too large: %v bytes > hash-max-ziplist-value(%v).", e.Index, e.Size, e.Limit)
+}
+
+// SetOversizePolicy sets the policy of record data whose stored value is longer than "hash-max-ziplist-value".
+// "hash-max-ziplist-value" is read from Redis config in Open(). The default policy is OversizeAllow.
+// Index buckets still store the record data for search, keep the data short to keep index buckets "ziplist" encoded.
+func (db *DB) SetOversizePolicy(policy OversizePolicy) {
+	db.oversizePolicy = policy
+}
+
+// genOverflowKey generates the overflow key of given record id.
+func (db *DB) genOverflowKey(id uint64) string {
+	return fmt.Sprintf("%v/overflow/%v", db.name, id)
+}
+
+// genTrashOverflowKey generates the overflow key of given trashed record id.
+func (db *DB) genTrashOverflowKey(id uint64) string {
+	return fmt.Sprintf("%v/trash/overflow/%v", db.name, id)
+}
+
+// checkDataSize returns *DataTooLargeError if the stored value of the i-th data in the batch is too long in OversizeReject mode.
+func (db *DB) checkDataSize(i int, data string) (err error) {
+	var v string
+
+	if db.oversizePolicy != OversizeReject {
+		return nil
+	}
+
+	if v, err = db.encodeData(data); err != nil {
+		return err
+	}
+
+	if uint64(len(v)) > db.redisHashMaxZiplistValue {
+		return &DataTooLargeError{Index: i, Size: uint64(len(v)), Limit: db.redisHashMaxZiplistValue}
+	}
+	return nil
+}
+
+// checkDataSizes checks the size of each data in the batch. Error of each item is stored in errs. Empty data is not checked.
+func (db *DB) checkDataSizes(dataArr []string) (errs []error) {
+	for i, data := range dataArr {
+		if len(data) == 0 {
+			errs = append(errs, nil)
+			continue
+		}
+		errs = append(errs, db.checkDataSize(i, data))
+	}
+	return errs
+}
+
+// queueSetValue queues the commands to store the record data as the field of the hash in the transaction.
+// The value is stored in overflowKey and the field stores the reference if it's too long in OversizeOverflow mode.
+func (db *DB) queueSetValue(t *tx, hashKey string, id uint64, overflowKey, data string) (err error) {
+	var v string
+
+	if v, err = db.encodeData(data); err != nil {
+		return err
+	}
+
+	if db.oversizePolicy == OversizeOverflow && uint64(len(v)) > db.redisHashMaxZiplistValue {
+		t.send("SET", overflowKey, v)
+		v = string([]byte{encodedMark, encodedOverflow}) + strings.TrimPrefix(overflowKey, db.name+"/")
+	}
+
+	t.send("HSET", hashKey, id, v)
+	return nil
+}
+
+// parseOverflowKey returns the overflow key referenced by the value. It returns false if the value is not a reference.
+func (db *DB) parseOverflowKey(v string) (k string, ok bool) {
+	if len(v) < 2 || v[0] != encodedMark || v[1] != encodedOverflow {
+		return "", false
+	}
+	return db.name + "/" + v[2:], true
+}
+
+// loadOverflow returns the value stored in the overflow key if v is a reference, otherwise it returns v.
+func (db *DB) loadOverflow(v string) (loaded string, err error) {
+	k, ok := db.parseOverflowKey(v)
+	if !ok {
+		return v, nil
+	}
+
+	if loaded, err = redis.String(db.c.Do("GET", k)); err != nil {
+		if err == redis.ErrNil {
+			return "", fmt.Errorf("Overflow key %v not found.", k)
+		}
+		return "", err
+	}
+	return loaded, nil
+}
+
+// ListOverflow returns the ids of records stored in overflow keys. IDs are sorted in ascending order.
+func (db *DB) ListOverflow() (ids []string, err error) {
+	var cursor, nID uint64
+	var v []interface{}
+	keys := []string{}
+	nIDs := []uint64{}
+	prefix := db.name + "/overflow/"
+	ids = []string{}
+
+	for {
+		if v, err = redis.Values(db.c.Do("SCAN", cursor, "match", escapeGlob(prefix)+"*", "COUNT", 1024)); err != nil {
+			goto end
+		}
+
+		if _, err = redis.Scan(v, &cursor, &keys); err != nil {
+			goto end
+		}
+
+		for _, k := range keys {
+			if nID, err = strconv.ParseUint(strings.TrimPrefix(k, prefix), 10, 64); err != nil {
+				goto end
+			}
+			nIDs = append(nIDs, nID)
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// SCAN may return a key more than once.
+	sort.Slice(nIDs, func(i, j int) bool { return nIDs[i] < nIDs[j] })
+	for i, nID := range nIDs {
+		if i > 0 && nID == nIDs[i-1] {
+			continue
+		}
+		ids = append(ids, strconv.FormatUint(nID, 10))
+	}
+
+end:
+	if err != nil {
+		debugPrintf("ListOverflow() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,61 @@
+package simpledb_test
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetOversizePolicy() {
+	var err error
+	var db *simpledb.DB
+	var id string
+	var r simpledb.Record
+	var ids []string
+	var tooLargeErr *simpledb.DataTooLargeError
+	// Default "hash-max-ziplist-value" of Redis is 64.
+	data := `{"name":"Tony","bio":"` + strings.Repeat("a", 128) + `"}`
+
+	log.Printf("\n")
+	log.Printf("--------- SetOversizePolicy() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "overflow-test")
+	defer db.Close()
+
+	// Reject oversize data.
+	db.SetOversizePolicy(simpledb.OversizeReject)
+	_, err = db.Create(data)
+	if errors.As(err, &tooLargeErr) {
+		log.Printf("data is too large: %v bytes > %v\n", tooLargeErr.Size, tooLargeErr.Limit)
+		err = nil
+	}
+
+	// Store oversize data in overflow keys.
+	db.SetOversizePolicy(simpledb.OversizeOverflow)
+	if id, err = db.Create(data); err != nil {
+		goto end
+	}
+
+	if r, err = db.Get(id); err != nil {
+		goto end
+	}
+	log.Printf("record: %v\n", r)
+
+	if ids, err = db.ListOverflow(); err != nil {
+		goto end
+	}
+	log.Printf("overflow record ids: %v\n", ids)
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetOversizePolicy() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,581 @@
+package simpledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// queryOp is the operator of query conditions.
+type queryOp int
+
+const (
+	queryEq queryOp = iota
+	queryPrefix
+	queryRange
+	queryGlob
+	queryRegexp
+	queryAnd
+	queryOr
+	queryNot
+)
+
+// Query is a structured query which combines conditions with boolean operators.
+// Create conditions by Eq(), Prefix(), Range(), Glob() and Regexp(), combine them by And(), Or() and Not(),
+// and execute the query by Find().
+//
+// Field indexes(see AddFieldIndex()) are used where available, other conditions are checked by scanning records.
+//
+//	Ex: And(Eq("city", "Shanghai"), Range("age", "18", "30"), Not(Prefix("name", "Fr")))
+type Query struct {
+	op       queryOp
+	field    string
+	value    string
+	min, max string
+	re       *regexp.Regexp
+	children []*Query
+	err      error
+	// opts are the sorting and paging options of the results. They're set by SortBy(), Limit() and Offset().
+	opts SearchOptions
+}
+
+// Eq matches records whose field equals the value.
+// String fields are compared by text, number fields are compared by number(Ex: 18.0 equals "18") and boolean fields match "true" or "false".
+// Any item matches if the field is an array.
+// Indexes are used only if they match the same records: the IndexPrefix index for non-number values,
+// and both IndexPrefix and IndexNumber indexes for number values. Otherwise records are scanned.
+func Eq(field, value string) *Query {
+	return &Query{op: queryEq, field: field, value: value}
+}
+
+// Prefix matches records whose string or number field starts with the prefix.
+func Prefix(field, prefix string) *Query {
+	return &Query{op: queryPrefix, field: field, value: prefix}
+}
+
+// Range matches records whose number or time field is between min and max. Bounds are the same as RangeSearch().
+// Bounds are numbers unless the field has an IndexTime index or any bound is not a number.
+func Range(field, min, max string) *Query {
+	return &Query{op: queryRange, field: field, min: min, max: max}
+}
+
+// Glob matches records whose data matches the glob-style pattern the same as the pattern of Search().
+func Glob(pattern string) *Query {
+	return &Query{op: queryGlob, value: pattern}
+}
+
+// Regexp matches records whose data matches the regexp pattern the same as the pattern of RegexpSearch().
+func Regexp(pattern string) *Query {
+	re, err := regexp.Compile(pattern)
+	return &Query{op: queryRegexp, value: pattern, re: re, err: err}
+}
+
+// And matches records which match all queries.
+func And(queries ...*Query) *Query {
+	return &Query{op: queryAnd, children: queries}
+}
+
+// Or matches records which match any query.
+func Or(queries ...*Query) *Query {
+	return &Query{op: queryOr, children: queries}
+}
+
+// Not matches records which do not match the query.
+func Not(q *Query) *Query {
+	return &Query{op: queryNot, children: []*Query{q}}
+}
+
+// String returns the text form of the query. It's used in debug messages.
+func (q *Query) String() string {
+	switch q.op {
+	case queryEq:
+		return fmt.Sprintf("%v = %q", q.field, q.value)
+	case queryPrefix:
+		return fmt.Sprintf("%v ^= %q", q.field, q.value)
+	case queryRange:
+		return fmt.Sprintf("%v in [%q, %q]", q.field, q.min, q.max)
+	case queryGlob:
+		return fmt.Sprintf("glob(%q)", q.value)
+	case queryRegexp:
+		return fmt.Sprintf("regexp(%q)", q.value)
+	case queryNot:
+		return fmt.Sprintf("NOT %v", q.children[0])
+	}
+
+	arr := []string{}
+	for _, c := range q.children {
+		arr = append(arr, c.String())
+	}
+
+	sep := " AND "
+	if q.op == queryOr {
+		sep = " OR "
+	}
+	return "(" + strings.Join(arr, sep) + ")"
+}
+
+// check checks the query recursively.
+func (q *Query) check() error {
+	if q == nil {
+		return fmt.Errorf("Nil query.")
+	}
+
+	if q.err != nil {
+		return q.err
+	}
+
+	switch q.op {
+	case queryEq, queryPrefix, queryRange:
+		if len(q.field) == 0 {
+			return fmt.Errorf("Empty field: %v.", q)
+		}
+	case queryAnd, queryOr:
+		if len(q.children) == 0 {
+			return fmt.Errorf("And / Or needs at least one query.")
+		}
+	}
+
+	for _, c := range q.children {
+		if err := c.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeKind returns the index kind used to parse the bounds of the range query.
+func (db *DB) rangeKind(q *Query) IndexKind {
+	if _, ok := db.findFieldIndex(q.field, IndexNumber); ok {
+		return IndexNumber
+	}
+
+	if _, ok := db.findFieldIndex(q.field, IndexTime); ok {
+		return IndexTime
+	}
+
+	for _, bound := range []string{q.min, q.max} {
+		if _, err := parseRangeBound(IndexNumber, bound); err != nil {
+			return IndexTime
+		}
+	}
+	return IndexNumber
+}
+
+// isNumberValue checks if the value of Eq() is a finite number.
+func isNumberValue(s string) bool {
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// findQueryIndexes returns the field indexes which resolve the query together(union of the results).
+// They match exactly the same records as match(). It returns false if the query should be checked by scanning.
+func (db *DB) findQueryIndexes(q *Query) (idxs []fieldIndex, ok bool) {
+	var idx, numberIdx fieldIndex
+
+	if db.encrypted {
+		return nil, false
+	}
+
+	switch q.op {
+	case queryEq:
+		// Boolean values are not indexed.
+		if q.value == "true" || q.value == "false" {
+			return nil, false
+		}
+
+		// The IndexPrefix index matches strings and numbers by text.
+		if idx, ok = db.findFieldIndex(q.field, IndexPrefix); !ok {
+			return nil, false
+		}
+
+		// Numbers which equal the value by number but not by text(Ex: 18.0 and 18) are matched by the IndexNumber index.
+		if isNumberValue(q.value) {
+			if numberIdx, ok = db.findFieldIndex(q.field, IndexNumber); !ok {
+				return nil, false
+			}
+			return []fieldIndex{idx, numberIdx}, true
+		}
+		return []fieldIndex{idx}, true
+	case queryPrefix:
+		idx, ok = db.findFieldIndex(q.field, IndexPrefix)
+	case queryRange:
+		idx, ok = db.findFieldIndex(q.field, db.rangeKind(q))
+	}
+
+	if !ok {
+		return nil, false
+	}
+	return []fieldIndex{idx}, true
+}
+
+// indexed checks if the query can be resolved by field indexes.
+func (db *DB) indexed(q *Query) bool {
+	switch q.op {
+	case queryAnd, queryOr:
+		for _, c := range q.children {
+			if !db.indexed(c) {
+				return false
+			}
+		}
+		return true
+	}
+
+	_, ok := db.findQueryIndexes(q)
+	return ok
+}
+
+// resolve gets the ids of records which match the query by field indexes. The query should be indexed.
+func (db *DB) resolve(q *Query) (ids map[uint64]struct{}, err error) {
+	var members []string
+	var min, max rangeBound
+	var nID uint64
+
+	switch q.op {
+	case queryAnd, queryOr:
+		for i, c := range q.children {
+			var childIDs map[uint64]struct{}
+
+			if childIDs, err = db.resolve(c); err != nil {
+				return nil, err
+			}
+
+			if i == 0 {
+				ids = childIDs
+			} else if q.op == queryAnd {
+				ids = intersectIDs(ids, childIDs)
+			} else {
+				for id := range childIDs {
+					ids[id] = struct{}{}
+				}
+			}
+		}
+		return ids, nil
+	}
+
+	idxs, _ := db.findQueryIndexes(q)
+	ids = make(map[uint64]struct{})
+
+	for _, idx := range idxs {
+		k := db.genFieldIndexKey(idx)
+
+		switch q.op {
+		case queryEq:
+			if idx.kind == IndexNumber {
+				f, _ := strconv.ParseFloat(q.value, 64)
+				members, err = redis.Strings(db.c.Do("ZRANGEBYSCORE", k, f, f))
+			} else {
+				members, err = redis.Strings(db.c.Do("ZRANGEBYLEX", k, "["+q.value+"\x00", "["+q.value+"\x00\xff"))
+			}
+		case queryPrefix:
+			members, err = redis.Strings(db.c.Do("ZRANGEBYLEX", k, "["+q.value, "["+q.value+"\xff"))
+		case queryRange:
+			if min, err = parseRangeBound(idx.kind, q.min); err != nil {
+				return nil, err
+			}
+
+			if max, err = parseRangeBound(idx.kind, q.max); err != nil {
+				return nil, err
+			}
+			members, err = redis.Strings(db.c.Do("ZRANGEBYSCORE", k, min.score("-inf"), max.score("+inf")))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range members {
+			if nID, err = strconv.ParseUint(parseFieldIndexMember(m), 10, 64); err != nil {
+				return nil, err
+			}
+			ids[nID] = struct{}{}
+		}
+	}
+	return ids, nil
+}
+
+// intersectIDs returns the ids in both a and b.
+func intersectIDs(a, b map[uint64]struct{}) map[uint64]struct{} {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	ids := make(map[uint64]struct{})
+	for id := range a {
+		if _, ok := b[id]; ok {
+			ids[id] = struct{}{}
+		}
+	}
+	return ids
+}
+
+// eqValue checks if the JSON value equals the string.
+func eqValue(v interface{}, s string) bool {
+	switch v := v.(type) {
+	case string:
+		return v == s
+	case json.Number:
+		if v.String() == s {
+			return true
+		}
+
+		f1, err1 := v.Float64()
+		f2, err2 := strconv.ParseFloat(s, 64)
+		return err1 == nil && err2 == nil && f1 == f2
+	case bool:
+		return strconv.FormatBool(v) == s
+	}
+	return false
+}
+
+// match checks if the record data matches the query. v is the decoded JSON value of the data.
+func (db *DB) match(q *Query, data string, v interface{}) (matched bool, err error) {
+	var min, max rangeBound
+	var t time.Time
+
+	switch q.op {
+	case queryEq:
+		for _, fv := range getFieldValues(v, q.field) {
+			if eqValue(fv, q.value) {
+				return true, nil
+			}
+		}
+	case queryPrefix:
+		for _, fv := range getFieldValues(v, q.field) {
+			switch fv := fv.(type) {
+			case string:
+				if strings.HasPrefix(fv, q.value) {
+					return true, nil
+				}
+			case json.Number:
+				if strings.HasPrefix(fv.String(), q.value) {
+					return true, nil
+				}
+			}
+		}
+	case queryRange:
+		kind := db.rangeKind(q)
+		if min, err = parseRangeBound(kind, q.min); err != nil {
+			return false, err
+		}
+
+		if max, err = parseRangeBound(kind, q.max); err != nil {
+			return false, err
+		}
+
+		for _, fv := range getFieldValues(v, q.field) {
+			switch fv := fv.(type) {
+			case json.Number:
+				if f, err := fv.Float64(); err == nil && kind == IndexNumber && inRange(f, min, max) {
+					return true, nil
+				}
+			case string:
+				if kind != IndexTime {
+					continue
+				}
+
+				if t, err = parseTime(fv); err == nil && inRange(float64(t.UnixMilli()), min, max) {
+					return true, nil
+				}
+			}
+		}
+	case queryGlob:
+		return globMatch(q.value, data), nil
+	case queryRegexp:
+		return q.re.MatchString(data), nil
+	case queryAnd:
+		for _, c := range q.children {
+			if matched, err = db.match(c, data, v); err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case queryOr:
+		for _, c := range q.children {
+			if matched, err = db.match(c, data, v); err != nil || matched {
+				return matched, err
+			}
+		}
+	case queryNot:
+		if matched, err = db.match(q.children[0], data, v); err != nil {
+			return false, err
+		}
+		return !matched, nil
+	}
+	return false, nil
+}
+
+// filterIDs gets the records of the candidate ids and returns the ids of records which match the query.
+func (db *DB) filterIDs(candidates map[uint64]struct{}, q *Query) (ids map[uint64]struct{}, err error) {
+	var records []Record
+	var matched bool
+	arr := []string{}
+	ids = make(map[uint64]struct{})
+
+	for id := range candidates {
+		arr = append(arr, strconv.FormatUint(id, 10))
+	}
+
+	for start := 0; start < len(arr); start += KeyBatchSize {
+		end := start + KeyBatchSize
+		if end > len(arr) {
+			end = len(arr)
+		}
+
+		if records, err = db.batchGet(arr[start:end]); err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			// The record is deleted after the index is read.
+			if len(r.Data) == 0 {
+				continue
+			}
+
+			v, _ := decodeJSON(r.Data)
+			if matched, err = db.match(q, r.Data, v); err != nil {
+				return nil, err
+			}
+
+			if matched {
+				nID, _ := strconv.ParseUint(r.ID, 10, 64)
+				ids[nID] = struct{}{}
+			}
+		}
+	}
+	return ids, nil
+}
+
+// scanIDs scans all records and returns the ids of records which match the query.
+func (db *DB) scanIDs(q *Query) (ids map[uint64]struct{}, err error) {
+	ids = make(map[uint64]struct{})
+
+	err = db.forEachRecord(func(id uint64, data string) error {
+		v, _ := decodeJSON(data)
+		matched, err := db.match(q, data, v)
+		if err != nil {
+			return err
+		}
+
+		if matched {
+			ids[id] = struct{}{}
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// execute gets the ids of records which match the query.
+// Indexed queries are resolved by field indexes. For And queries, indexed children are resolved first
+// and the other children are checked on the records of the result. Other queries are checked by scanning all records.
+func (db *DB) execute(q *Query) (ids map[uint64]struct{}, err error) {
+	var childIDs map[uint64]struct{}
+
+	if db.indexed(q) {
+		debugPrintf("execute(): query: %v, use indexes\n", q)
+		return db.resolve(q)
+	}
+
+	if q.op != queryAnd {
+		debugPrintf("execute(): query: %v, scan\n", q)
+		return db.scanIDs(q)
+	}
+
+	filters := []*Query{}
+	for _, c := range q.children {
+		if !db.indexed(c) {
+			filters = append(filters, c)
+			continue
+		}
+
+		if childIDs, err = db.resolve(c); err != nil {
+			return nil, err
+		}
+
+		if ids == nil {
+			ids = childIDs
+		} else {
+			ids = intersectIDs(ids, childIDs)
+		}
+	}
+
+	if ids == nil {
+		debugPrintf("execute(): query: %v, scan\n", q)
+		return db.scanIDs(q)
+	}
+
+	debugPrintf("execute(): query: %v, use indexes and filter %v records\n", q, len(ids))
+	return db.filterIDs(ids, And(filters...))
+}
+
+// Find returns the ids of records which match the query.
+//
+//	Returns:
+//	    ids: matched record ids sorted and paged by the options set by SortBy(), Limit() and Offset() of q(see SortIDs()).
+//	         They're sorted by id by default.
+func (db *DB) Find(q *Query) (ids []string, err error) {
+	hc := db.newHookContext(OpFind, nil, nil)
+	hc.Query = q
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if ids, err = db.find(hc.Query); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	}); err != nil {
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// find returns the ids of records which match the query sorted by id.
+func (db *DB) find(q *Query) (ids []string, err error) {
+	var m map[uint64]struct{}
+	nIDs := []uint64{}
+	ids = []string{}
+
+	if err = db.checkEncryption(); err != nil {
+		goto end
+	}
+
+	if err = q.check(); err != nil {
+		goto end
+	}
+
+	if m, err = db.execute(q); err != nil {
+		goto end
+	}
+
+	for id := range m {
+		nIDs = append(nIDs, id)
+	}
+	sort.Slice(nIDs, func(i, j int) bool { return nIDs[i] < nIDs[j] })
+
+	for _, id := range nIDs {
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+
+	if q.opts != (SearchOptions{}) {
+		if ids, err = db.SortIDs(ids, q.opts); err != nil {
+			goto end
+		}
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Find() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
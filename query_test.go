@@ -0,0 +1,145 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Find() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched []string
+
+	log.Printf("\n")
+	log.Printf("--------- Find() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "query-test")
+	defer db.Close()
+
+	// Conditions of indexed fields are resolved by indexes. Others are checked by scanning.
+	if err = db.AddFieldIndex("city", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if err = db.AddFieldIndex("age", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Frank","age":25,"city":"Shanghai"}`,
+		`{"name":"Jack","age":28,"city":"Shanghai"}`,
+		`{"name":"Lily","age":16,"city":"Shanghai"}`,
+		`{"name":"Tom","age":35,"city":"Beijing"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Records in Shanghai, age between 18 and 30 and name not starting with "Fr", or records in Beijing.
+	if matched, err = db.Find(simpledb.Or(
+		simpledb.And(
+			simpledb.Eq("city", "Shanghai"),
+			simpledb.Range("age", "18", "30"),
+			simpledb.Not(simpledb.Prefix("name", "Fr")),
+		),
+		simpledb.Eq("city", "Beijing"),
+	)); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	// Glob and regexp conditions on record data.
+	if matched, err = db.Find(simpledb.And(
+		simpledb.Glob(`*"city":"Shanghai"*`),
+		simpledb.Regexp(`"name":"(Frank|Lily)"`),
+	)); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Find() Test End --------\n")
+	// Output:
+}
+
+func ExampleEq() {
+	var err error
+	var db *simpledb.DB
+	var ids, scanned, indexed []string
+
+	log.Printf("\n")
+	log.Printf("--------- Eq() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "query-eq-test")
+	defer db.Close()
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Alice","code":"18"}`,
+		`{"name":"Bob","code":18}`,
+		`{"name":"Carol","code":18.0}`,
+		`{"name":"Dave","code":"18.0"}`,
+		`{"name":"Eve","code":true}`,
+	}); err != nil {
+		goto end
+	}
+
+	// No index: records are scanned. Alice, Bob and Carol match.
+	if scanned, err = db.Find(simpledb.Eq("code", "18")); err != nil {
+		goto end
+	}
+
+	// Number values are resolved by both IndexPrefix and IndexNumber indexes.
+	if err = db.AddFieldIndex("code", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if err = db.AddFieldIndex("code", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+	if _, err = db.RebuildFieldIndex("code", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if _, err = db.RebuildFieldIndex("code", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+	// The same records match by indexes.
+	if indexed, err = db.Find(simpledb.Eq("code", "18")); err != nil {
+		goto end
+	}
+	log.Printf("scanned: %v, indexed: %v\n", scanned, indexed)
+
+	// Boolean values are not indexed, records are scanned. Eve matches.
+	if indexed, err = db.Find(simpledb.Eq("code", "true")); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", indexed)
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+	if err = db.DropFieldIndex("code", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if err = db.DropFieldIndex("code", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Eq() Test End --------\n")
+	// Output:
+}
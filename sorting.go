@@ -0,0 +1,557 @@
+package simpledb
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// SortOrder is the order of sorting.
+type SortOrder int
+
+const (
+	// Asc sorts in ascending order.
+	Asc SortOrder = iota
+	// Desc sorts in descending order.
+	Desc
+)
+
+const (
+	// SortIndexMaxRatio is the max ratio of the number of members of the field index to the number of ids
+	// for SortIDs() to walk the index. Records are sorted in memory if the index is larger.
+	SortIndexMaxRatio = 8
+)
+
+// SearchOptions are the sorting and paging options of search results.
+type SearchOptions struct {
+	// SortBy is the field to sort by. Nested fields are separated by ".". Results are sorted by id if it's empty.
+	// Numbers are sorted by value and strings are sorted byte by byte. Numbers come before strings,
+	// and records without the field come last in both orders. Records of the same value are sorted by id.
+	// The first item is used if the field is an array.
+	SortBy string
+	// Order is the order of sorting: Asc or Desc.
+	Order SortOrder
+	// Limit is the max number of ids to return. No limit if it's 0.
+	Limit uint64
+	// Offset is the number of sorted ids to skip.
+	Offset uint64
+}
+
+// SortBy sets the field and order to sort the results of Find().
+func (q *Query) SortBy(field string, order SortOrder) *Query {
+	q.opts.SortBy = field
+	q.opts.Order = order
+	return q
+}
+
+// Limit sets the max number of ids returned by Find(). No limit if it's 0.
+func (q *Query) Limit(n uint64) *Query {
+	q.opts.Limit = n
+	return q
+}
+
+// Offset sets the number of sorted ids skipped by Find().
+func (q *Query) Offset(n uint64) *Query {
+	q.opts.Offset = n
+	return q
+}
+
+// sortKey is the key to sort a record.
+type sortKey struct {
+	id uint64
+	// kind: 0: number, 1: string, 2: no field.
+	kind int
+	num  float64
+	str  string
+}
+
+// newSortKey creates the sort key of the record by the first value of the field.
+func newSortKey(id uint64, data, field string) sortKey {
+	v, _ := decodeJSON(data)
+	for _, fv := range getFieldValues(v, field) {
+		switch fv := fv.(type) {
+		case json.Number:
+			if f, err := fv.Float64(); err == nil {
+				return sortKey{id: id, kind: 0, num: f}
+			}
+		case string:
+			return sortKey{id: id, kind: 1, str: fv}
+		}
+	}
+	return sortKey{id: id, kind: 2}
+}
+
+// lessSortKey reports whether a comes before b in the order.
+func lessSortKey(a, b sortKey, order SortOrder) bool {
+	if a.kind != b.kind {
+		// Numbers come before strings and records without the field come last in both orders.
+		return a.kind < b.kind
+	}
+
+	switch {
+	case a.kind == 0 && a.num != b.num:
+		return (a.num < b.num) != (order == Desc)
+	case a.kind == 1 && a.str != b.str:
+		return (a.str < b.str) != (order == Desc)
+	}
+	return a.id < b.id
+}
+
+// sortKeyHeap is a heap of sort keys. The last key in the order is at the top so that top-K keys can be kept.
+type sortKeyHeap struct {
+	keys  []sortKey
+	order SortOrder
+}
+
+func (h *sortKeyHeap) Len() int           { return len(h.keys) }
+func (h *sortKeyHeap) Less(i, j int) bool { return lessSortKey(h.keys[j], h.keys[i], h.order) }
+func (h *sortKeyHeap) Swap(i, j int)      { h.keys[i], h.keys[j] = h.keys[j], h.keys[i] }
+func (h *sortKeyHeap) Push(x interface{}) { h.keys = append(h.keys, x.(sortKey)) }
+func (h *sortKeyHeap) Pop() interface{} {
+	k := h.keys[len(h.keys)-1]
+	h.keys = h.keys[:len(h.keys)-1]
+	return k
+}
+
+// page returns the ids in [offset, offset + limit).
+func page(nIDs []uint64, opts SearchOptions) (ids []string) {
+	ids = []string{}
+
+	start := opts.Offset
+	if start > uint64(len(nIDs)) {
+		start = uint64(len(nIDs))
+	}
+
+	end := uint64(len(nIDs))
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+	}
+
+	for _, id := range nIDs[start:end] {
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+	return ids
+}
+
+// sortCandidate is a record found by walking a field index to sort.
+type sortCandidate struct {
+	id uint64
+	// value is the value text of the member.
+	value string
+	// score is the score of the member. It's the number value for IndexNumber indexes.
+	score float64
+}
+
+// walkSortIndex walks the members of the index in the order and collects the ids in the set which are not seen.
+// Seen ids are added to seen. It stops when need ids are collected and the value of the next member is different from the last one,
+// because records of the same value are sorted by id. It returns true if the index is walked to the end.
+func (db *DB) walkSortIndex(idx fieldIndex, order SortOrder, set, seen map[uint64]struct{}, need uint64) (candidates []sortCandidate, exhausted bool, err error) {
+	var values []interface{}
+	var member string
+	var c, last sortCandidate
+	var ok bool
+	k := db.genFieldIndexKey(idx)
+	cmd := "ZRANGE"
+
+	if order == Desc {
+		cmd = "ZREVRANGE"
+	}
+
+	for start := 0; ; start += KeyBatchSize {
+		if values, err = redis.Values(db.c.Do(cmd, k, start, start+KeyBatchSize-1, "WITHSCORES")); err != nil {
+			return nil, false, err
+		}
+
+		for i := 0; i+1 < len(values); i += 2 {
+			if member, err = redis.String(values[i], nil); err != nil {
+				return nil, false, err
+			}
+
+			c = sortCandidate{value: member[:strings.LastIndexByte(member, 0)]}
+			if c.score, err = redis.Float64(values[i+1], nil); err != nil {
+				return nil, false, err
+			}
+
+			if uint64(len(candidates)) >= need {
+				if (idx.kind == IndexNumber && c.score != last.score) || (idx.kind != IndexNumber && c.value != last.value) {
+					return candidates, false, nil
+				}
+			}
+
+			if c.id, err = strconv.ParseUint(parseFieldIndexMember(member), 10, 64); err != nil {
+				return nil, false, err
+			}
+
+			if _, ok = set[c.id]; !ok {
+				continue
+			}
+
+			// Array fields have more than one member of a record.
+			if _, ok = seen[c.id]; ok {
+				continue
+			}
+
+			seen[c.id] = struct{}{}
+			candidates = append(candidates, c)
+			last = c
+		}
+
+		if len(values) < KeyBatchSize*2 {
+			return candidates, true, nil
+		}
+	}
+}
+
+// walkNumberTexts walks the members of the IndexPrefix index whose values may be numbers("-" or digits followed by others)
+// and collects the ids in the set.
+func (db *DB) walkNumberTexts(idx fieldIndex, set map[uint64]struct{}) (candidates []sortCandidate, err error) {
+	var members []string
+	var nID uint64
+	k := db.genFieldIndexKey(idx)
+
+	// "(." and "(:" exclude the bytes after "-" and "9".
+	for _, r := range [][2]string{{"[-", "(."}, {"[0", "(:"}} {
+		for offset := 0; ; offset += KeyBatchSize {
+			if members, err = redis.Strings(db.c.Do("ZRANGEBYLEX", k, r[0], r[1], "LIMIT", offset, KeyBatchSize)); err != nil {
+				return nil, err
+			}
+
+			for _, m := range members {
+				if nID, err = strconv.ParseUint(parseFieldIndexMember(m), 10, 64); err != nil {
+					return nil, err
+				}
+
+				if _, ok := set[nID]; ok {
+					candidates = append(candidates, sortCandidate{id: nID, value: m[:strings.LastIndexByte(m, 0)]})
+				}
+			}
+
+			if len(members) < KeyBatchSize {
+				break
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// readSortKeys reads the records of the candidates and returns their sort keys in the same order.
+func (db *DB) readSortKeys(candidates []sortCandidate, field string) (keys []sortKey, err error) {
+	var records []Record
+	arr := []string{}
+
+	for _, c := range candidates {
+		arr = append(arr, strconv.FormatUint(c.id, 10))
+	}
+
+	for start := 0; start < len(arr); start += KeyBatchSize {
+		end := start + KeyBatchSize
+		if end > len(arr) {
+			end = len(arr)
+		}
+
+		if records, err = db.batchGet(arr[start:end]); err != nil {
+			return nil, err
+		}
+
+		for i, r := range records {
+			keys = append(keys, newSortKey(candidates[start+i].id, r.Data, field))
+		}
+	}
+	return keys, nil
+}
+
+// sortByIndex sorts the ids by walking the field indexes in order.
+// Numbers are found by the IndexNumber index(or the number values of the IndexPrefix index),
+// and strings are found by walking the IndexPrefix index after the numbers.
+// It stops when offset + limit ids and the ids of the same value as the last one are found.
+// The records of found ids are read to check that their first values are the indexed values(not the other items of arrays).
+// It returns false if the field has no index, the indexes are too large for the ids,
+// or the first offset + limit ids can not be sorted by the indexes. The ids should be sorted in memory then.
+func (db *DB) sortByIndex(set map[uint64]struct{}, opts SearchOptions) (nIDs []uint64, ok bool, err error) {
+	var numIdx, prefixIdx fieldIndex
+	var hasNum, hasPrefix, exhausted bool
+	var n uint64
+	var candidates []sortCandidate
+	var keys []sortKey
+	var f float64
+	numKeys := []sortKey{}
+	strKeys := []sortKey{}
+	seen := make(map[uint64]struct{})
+	need := opts.Offset + opts.Limit
+
+	if db.encrypted {
+		return nil, false, nil
+	}
+
+	numIdx, hasNum = db.findFieldIndex(opts.SortBy, IndexNumber)
+	prefixIdx, hasPrefix = db.findFieldIndex(opts.SortBy, IndexPrefix)
+
+	indexes := []fieldIndex{}
+	if hasNum {
+		indexes = append(indexes, numIdx)
+	}
+
+	if hasPrefix {
+		indexes = append(indexes, prefixIdx)
+	}
+
+	for _, idx := range indexes {
+		if n, err = redis.Uint64(db.c.Do("ZCARD", db.genFieldIndexKey(idx))); err != nil {
+			return nil, false, err
+		}
+
+		if n > uint64(len(set))*SortIndexMaxRatio {
+			return nil, false, nil
+		}
+	}
+
+	// Numbers come before strings in both orders.
+	switch {
+	case hasNum:
+		if candidates, exhausted, err = db.walkSortIndex(numIdx, opts.Order, set, seen, need); err != nil {
+			return nil, false, err
+		}
+
+		if keys, err = db.readSortKeys(candidates, opts.SortBy); err != nil {
+			return nil, false, err
+		}
+
+		for i, key := range keys {
+			// The first item of an array is not the indexed number, or the record is deleted.
+			if key.kind != 0 || key.num != candidates[i].score {
+				return nil, false, nil
+			}
+			numKeys = append(numKeys, key)
+		}
+	case hasPrefix:
+		if candidates, err = db.walkNumberTexts(prefixIdx, set); err != nil {
+			return nil, false, err
+		}
+
+		if keys, err = db.readSortKeys(candidates, opts.SortBy); err != nil {
+			return nil, false, err
+		}
+
+		for i, key := range keys {
+			// Strings which start with "-" or digits are found by walking the index later.
+			if key.kind == 1 {
+				continue
+			}
+
+			if _, ok = seen[key.id]; ok {
+				continue
+			}
+
+			if f, err = strconv.ParseFloat(candidates[i].value, 64); err != nil || key.kind != 0 || key.num != f {
+				return nil, false, nil
+			}
+
+			seen[key.id] = struct{}{}
+			numKeys = append(numKeys, key)
+		}
+		exhausted = true
+	default:
+		return nil, false, nil
+	}
+
+	sort.Slice(numKeys, func(i, j int) bool { return lessSortKey(numKeys[i], numKeys[j], opts.Order) })
+	for _, key := range numKeys {
+		nIDs = append(nIDs, key.id)
+	}
+
+	if !exhausted || uint64(len(nIDs)) >= need {
+		return nIDs, true, nil
+	}
+
+	if !hasPrefix {
+		return nil, false, nil
+	}
+
+	if candidates, exhausted, err = db.walkSortIndex(prefixIdx, opts.Order, set, seen, need-uint64(len(nIDs))); err != nil {
+		return nil, false, err
+	}
+
+	if keys, err = db.readSortKeys(candidates, opts.SortBy); err != nil {
+		return nil, false, err
+	}
+
+	for i, key := range keys {
+		// The first item of an array is not the indexed string, or the record is deleted.
+		if key.kind != 1 || key.str != candidates[i].value {
+			return nil, false, nil
+		}
+		strKeys = append(strKeys, key)
+	}
+
+	sort.Slice(strKeys, func(i, j int) bool { return lessSortKey(strKeys[i], strKeys[j], opts.Order) })
+	for _, key := range strKeys {
+		nIDs = append(nIDs, key.id)
+	}
+
+	if !exhausted {
+		return nIDs, true, nil
+	}
+
+	// Both indexes are walked to the end. Other records have no number or string value and come last sorted by id.
+	rest := []uint64{}
+	for id := range set {
+		if _, ok = seen[id]; !ok {
+			rest = append(rest, id)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i] < rest[j] })
+
+	return append(nIDs, rest...), true, nil
+}
+
+// sortInMemory gets the records and sorts the ids by the field.
+// Only offset + limit keys are kept in memory if limit is set.
+func (db *DB) sortInMemory(set map[uint64]struct{}, opts SearchOptions) (nIDs []uint64, err error) {
+	var records []Record
+	var nID uint64
+	h := &sortKeyHeap{order: opts.Order}
+	arr := []string{}
+	k := 0
+
+	if opts.Limit > 0 {
+		k = int(opts.Offset + opts.Limit)
+	}
+
+	for id := range set {
+		arr = append(arr, strconv.FormatUint(id, 10))
+	}
+
+	for start := 0; start < len(arr); start += KeyBatchSize {
+		end := start + KeyBatchSize
+		if end > len(arr) {
+			end = len(arr)
+		}
+
+		if records, err = db.batchGet(arr[start:end]); err != nil {
+			return nil, err
+		}
+
+		for _, r := range records {
+			if nID, err = strconv.ParseUint(r.ID, 10, 64); err != nil {
+				return nil, err
+			}
+
+			key := newSortKey(nID, r.Data, opts.SortBy)
+			if k == 0 || h.Len() < k {
+				heap.Push(h, key)
+			} else if lessSortKey(key, h.keys[0], opts.Order) {
+				h.keys[0] = key
+				heap.Fix(h, 0)
+			}
+		}
+	}
+
+	sort.Slice(h.keys, func(i, j int) bool { return lessSortKey(h.keys[i], h.keys[j], opts.Order) })
+	for _, key := range h.keys {
+		nIDs = append(nIDs, key.id)
+	}
+	return nIDs, nil
+}
+
+// sortSearchResults sorts and pages the results of search APIs by the options(see SortIDs()).
+// If SortBy is empty and keepOrder is true, the order of the results(Ex: rank of TextSearch()) is kept
+// and it's reversed in descending order. Redundant ids are removed.
+func (db *DB) sortSearchResults(ids []string, opts SearchOptions, keepOrder bool) (sorted []string, err error) {
+	var nID uint64
+	set := make(map[uint64]struct{})
+	nIDs := []uint64{}
+
+	if len(opts.SortBy) != 0 || !keepOrder {
+		return db.SortIDs(ids, opts)
+	}
+
+	if opts.Order != Asc && opts.Order != Desc {
+		return []string{}, fmt.Errorf("Invalid sort order: %v.", opts.Order)
+	}
+
+	for _, id := range ids {
+		if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			return []string{}, err
+		}
+
+		if _, ok := set[nID]; !ok {
+			set[nID] = struct{}{}
+			nIDs = append(nIDs, nID)
+		}
+	}
+
+	if opts.Order == Desc {
+		for i, j := 0, len(nIDs)-1; i < j; i, j = i+1, j-1 {
+			nIDs[i], nIDs[j] = nIDs[j], nIDs[i]
+		}
+	}
+
+	return page(nIDs, opts), nil
+}
+
+// SortIDs sorts and pages the ids returned by search APIs(Ex: Search(), TextSearch(), Find()).
+// If limit is set and the field has the indexes of IndexNumber or IndexPrefix kind(see AddFieldIndex()) which are not much larger than the ids,
+// the indexes are walked in order until offset + limit ids are found: numbers by the IndexNumber index(or the IndexPrefix index),
+// and then strings by the IndexPrefix index.
+// Otherwise records are read and sorted in memory, and only offset + limit records are kept if limit is set.
+// Both ways return the same order.
+//
+//	Params:
+//	    ids: record ids. Redundant ids are removed.
+//	    opts: sorting and paging options.
+//	Returns:
+//	    sorted: sorted ids in [offset, offset + limit).
+func (db *DB) SortIDs(ids []string, opts SearchOptions) (sorted []string, err error) {
+	var nID uint64
+	var ok bool
+	set := make(map[uint64]struct{})
+	nIDs := []uint64{}
+
+	if opts.Order != Asc && opts.Order != Desc {
+		err = fmt.Errorf("Invalid sort order: %v.", opts.Order)
+		goto end
+	}
+
+	for _, id := range ids {
+		if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+			goto end
+		}
+		set[nID] = struct{}{}
+	}
+
+	switch {
+	case len(opts.SortBy) == 0:
+		for id := range set {
+			nIDs = append(nIDs, id)
+		}
+		sort.Slice(nIDs, func(i, j int) bool { return (nIDs[i] < nIDs[j]) != (opts.Order == Desc) })
+	default:
+		// Walk the indexes only if a few ids are needed.
+		if opts.Limit > 0 && opts.Offset+opts.Limit < uint64(len(set)) {
+			if nIDs, ok, err = db.sortByIndex(set, opts); err != nil {
+				goto end
+			}
+		}
+
+		if !ok {
+			if nIDs, err = db.sortInMemory(set, opts); err != nil {
+				goto end
+			}
+		}
+	}
+
+	sorted = page(nIDs, opts)
+
+end:
+	if err != nil {
+		debugPrintf("SortIDs() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return sorted, nil
+}
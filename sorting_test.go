@@ -0,0 +1,79 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SortIDs() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched, sorted []string
+	var results [][]string
+
+	log.Printf("\n")
+	log.Printf("--------- SortIDs() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "sort-test")
+	defer db.Close()
+
+	// Sorting by a field of IndexNumber index walks the index if a few ids are needed. Other fields are sorted in memory.
+	if err = db.AddFieldIndex("age", simpledb.IndexNumber); err != nil {
+		goto end
+	}
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Frank","age":25,"city":"Shanghai"}`,
+		`{"name":"Jack","age":28,"city":"Shanghai"}`,
+		`{"name":"Lily","age":16,"city":"Shanghai"}`,
+		`{"name":"Tom","age":35,"city":"Beijing"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// The second oldest in Shanghai.
+	if matched, err = db.Find(simpledb.Glob(`*"city":"Shanghai"*`).SortBy("age", simpledb.Desc).Limit(1).Offset(1)); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	// Sort the results of other search APIs by name.
+	if results, err = db.RegexpSearch([]string{`"name":"(Frank|Jack|Tom)"`}); err != nil {
+		goto end
+	}
+
+	if sorted, err = db.SortIDs(results[0], simpledb.SearchOptions{SortBy: "name", Order: simpledb.Asc, Limit: 2}); err != nil {
+		goto end
+	}
+	log.Printf("sorted: %v\n", sorted)
+
+	// Search with the options. The IndexPrefix index of name is walked to sort strings.
+	if err = db.AddFieldIndex("name", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if _, err = db.RebuildFieldIndex("name", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if sorted, err = db.SearchWithOptions(`*"city":"Shanghai"*`, simpledb.SearchOptions{SortBy: "name", Order: simpledb.Desc, Limit: 2}); err != nil {
+		goto end
+	}
+	log.Printf("searched and sorted: %v\n", sorted)
+
+	if err = db.DropFieldIndex("name", simpledb.IndexPrefix); err != nil {
+		goto end
+	}
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SortIDs() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,432 @@
+package simpledb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// SetTextSearch sets text search mode.
+// In text search mode, every create, update and delete maintains an inverted index(tokenized words -> record id sets)
+// in the same transaction, so that TextSearch() finds records without scanning.
+// If record data is JSON, only string and number values are tokenized(field names are not).
+// All clients which write records should enable it. Call RebuildTextIndex() to index existing records.
+// The inverted index is not maintained for encrypted databases(see SetEncryption()).
+func (db *DB) SetTextSearch(on bool) {
+	db.textIndex = on
+}
+
+// genTextTermKey generates the key of the record id set of given term.
+func (db *DB) genTextTermKey(term string) string {
+	return fmt.Sprintf("%v/text/term/%v", db.name, term)
+}
+
+// genTextTermsKey generates the key of all terms.
+// It's a sorted set. Member: term, score: 0. It's used to expand prefix terms by ZRANGEBYLEX.
+func (db *DB) genTextTermsKey() string {
+	return fmt.Sprintf("%v/text/terms", db.name)
+}
+
+// tokenize splits the text into lower case terms. Letters and numbers are kept and other characters are separators.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// collectJSONValues appends the string and number values of the decoded JSON value to texts.
+func collectJSONValues(v interface{}, texts []string) []string {
+	switch v := v.(type) {
+	case string:
+		texts = append(texts, v)
+	case json.Number:
+		texts = append(texts, v.String())
+	case []interface{}:
+		for _, item := range v {
+			texts = collectJSONValues(item, texts)
+		}
+	case map[string]interface{}:
+		for _, item := range v {
+			texts = collectJSONValues(item, texts)
+		}
+	}
+	return texts
+}
+
+// textTerms returns the distinct terms of the record data.
+func textTerms(data string) map[string]struct{} {
+	texts := []string{data}
+	terms := make(map[string]struct{})
+
+	if v, ok := decodeJSON(data); ok {
+		texts = collectJSONValues(v, nil)
+	}
+
+	for _, text := range texts {
+		for _, term := range tokenize(text) {
+			terms[term] = struct{}{}
+		}
+	}
+	return terms
+}
+
+// queueTextIndex queues the commands to update the inverted index of a record in the transaction.
+// oldData is empty for new records and data is empty for deleted records.
+// It's a no-op if text search mode is disabled or the database is encrypted.
+func (db *DB) queueTextIndex(t *tx, id uint64, oldData, data string) {
+	if !db.textIndex || db.encrypted {
+		return
+	}
+
+	oldTerms := textTerms(oldData)
+	newTerms := textTerms(data)
+
+	for term := range oldTerms {
+		if _, ok := newTerms[term]; !ok {
+			t.send("SREM", db.genTextTermKey(term), id)
+		}
+	}
+
+	for term := range newTerms {
+		if _, ok := oldTerms[term]; !ok {
+			t.send("SADD", db.genTextTermKey(term), id)
+			t.send("ZADD", db.genTextTermsKey(), 0, term)
+		}
+	}
+}
+
+// textTerm is a term of text search queries.
+type textTerm struct {
+	term   string
+	prefix bool
+	not    bool
+}
+
+// parseTextQuery parses the text search query into clauses. Records match any clause(OR) and all terms of the clause(AND).
+func parseTextQuery(query string) (clauses [][]textTerm, err error) {
+	clause := []textTerm{}
+	not := false
+
+	endClause := func() error {
+		positive := false
+		for _, t := range clause {
+			if !t.not {
+				positive = true
+			}
+		}
+
+		if !positive {
+			return fmt.Errorf("Each clause of the query needs at least one term without NOT: %v.", query)
+		}
+		clauses = append(clauses, clause)
+		clause = []textTerm{}
+		return nil
+	}
+
+	for _, word := range strings.Fields(query) {
+		switch {
+		case word == "OR":
+			if not {
+				return nil, fmt.Errorf("NOT should be followed by a term: %v.", query)
+			}
+
+			if err = endClause(); err != nil {
+				return nil, err
+			}
+			continue
+		case word == "AND":
+			continue
+		case word == "NOT":
+			not = true
+			continue
+		case strings.HasPrefix(word, "-"):
+			not = true
+			word = word[1:]
+		}
+
+		prefix := strings.HasSuffix(word, "*")
+		terms := tokenize(strings.TrimSuffix(word, "*"))
+		for i, term := range terms {
+			clause = append(clause, textTerm{term: term, prefix: prefix && i == len(terms)-1, not: not})
+		}
+		not = false
+	}
+
+	if not {
+		return nil, fmt.Errorf("NOT should be followed by a term: %v.", query)
+	}
+
+	if err = endClause(); err != nil {
+		return nil, err
+	}
+	return clauses, nil
+}
+
+// getTextTermIDs returns the ids of records which contain the term.
+func (db *DB) getTextTermIDs(t textTerm) (ids map[uint64]struct{}, err error) {
+	var members, terms []string
+	var nID uint64
+	ids = make(map[uint64]struct{})
+
+	if !t.prefix {
+		terms = []string{t.term}
+	} else {
+		// Expand the prefix term. "\xff" is greater than all bytes of UTF-8 strings.
+		if terms, err = redis.Strings(db.c.Do("ZRANGEBYLEX", db.genTextTermsKey(), "["+t.term, "["+t.term+"\xff")); err != nil {
+			return nil, err
+		}
+
+		if len(terms) == 0 {
+			return ids, nil
+		}
+	}
+
+	args := []interface{}{}
+	for _, term := range terms {
+		args = append(args, db.genTextTermKey(term))
+	}
+
+	if members, err = redis.Strings(db.c.Do("SUNION", args...)); err != nil {
+		return nil, err
+	}
+
+	for _, m := range members {
+		if nID, err = strconv.ParseUint(m, 10, 64); err != nil {
+			return nil, err
+		}
+		ids[nID] = struct{}{}
+	}
+	return ids, nil
+}
+
+// TextSearch searches records by the inverted index maintained in text search mode(see SetTextSearch()).
+//
+//	Params:
+//	    query: terms separated by spaces. Terms are matched case-insensitively.
+//	        "foo bar" or "foo AND bar": records contain both terms.
+//	        "foo OR bar": records contain any term. AND binds tighter than OR.
+//	        "-foo" or "NOT foo": records do not contain the term. Each clause needs at least one term without NOT.
+//	        "fo*": records contain terms starting with "fo".
+//	        Ex: `jack* tel OR frank -smith`
+//	Returns:
+//	    ids: matched record ids ranked by the number of matched terms(terms without NOT).
+//	         Records of the same rank are sorted by id.
+func (db *DB) TextSearch(query string) (ids []string, err error) {
+	hc := db.newHookContext(OpTextSearch, nil, []string{query})
+
+	if err = db.runHooks(hc, func() error {
+		var err error
+		if len(hc.Patterns) != 1 {
+			return fmt.Errorf("TextSearch() needs one query.")
+		}
+
+		if ids, err = db.textSearch(hc.Patterns[0]); err != nil {
+			return err
+		}
+
+		hc.Results = idRecords(ids)
+		return nil
+	}); err != nil {
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// TextSearchWithOptions is the same as TextSearch() but the results are sorted and paged by the options(see SortIDs()).
+// The rank order is kept if SortBy is empty(reversed in descending order).
+func (db *DB) TextSearchWithOptions(query string, opts SearchOptions) (ids []string, err error) {
+	if ids, err = db.TextSearch(query); err != nil {
+		return []string{}, err
+	}
+
+	if ids, err = db.sortSearchResults(ids, opts, true); err != nil {
+		debugPrintf("TextSearchWithOptions() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// textSearch searches records by the inverted index.
+func (db *DB) textSearch(query string) (ids []string, err error) {
+	var clauses [][]textTerm
+	var termIDs map[uint64]struct{}
+	cache := make(map[textTerm]map[uint64]struct{})
+	matched := make(map[uint64]struct{})
+	scores := make(map[uint64]int)
+	nIDs := []uint64{}
+	ids = []string{}
+
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
+	if clauses, err = parseTextQuery(query); err != nil {
+		goto end
+	}
+
+	// Get the id sets of all terms once.
+	for _, clause := range clauses {
+		for _, t := range clause {
+			key := textTerm{term: t.term, prefix: t.prefix}
+			if _, ok := cache[key]; ok {
+				continue
+			}
+
+			if termIDs, err = db.getTextTermIDs(key); err != nil {
+				goto end
+			}
+			cache[key] = termIDs
+		}
+	}
+
+	for _, clause := range clauses {
+		var result map[uint64]struct{}
+
+		// Intersect the sets of positive terms.
+		for _, t := range clause {
+			if t.not {
+				continue
+			}
+
+			termIDs = cache[textTerm{term: t.term, prefix: t.prefix}]
+			if result == nil {
+				result = make(map[uint64]struct{})
+				for id := range termIDs {
+					result[id] = struct{}{}
+				}
+				continue
+			}
+
+			for id := range result {
+				if _, ok := termIDs[id]; !ok {
+					delete(result, id)
+				}
+			}
+		}
+
+		// Exclude the sets of negative terms.
+		for _, t := range clause {
+			if !t.not {
+				continue
+			}
+
+			for id := range cache[textTerm{term: t.term, prefix: t.prefix}] {
+				delete(result, id)
+			}
+		}
+
+		for id := range result {
+			matched[id] = struct{}{}
+		}
+	}
+
+	// Rank by the number of distinct positive terms contained by each record.
+	for key, termIDs := range cache {
+		if !isPositiveTerm(clauses, key) {
+			continue
+		}
+
+		for id := range termIDs {
+			if _, ok := matched[id]; ok {
+				scores[id]++
+			}
+		}
+	}
+
+	for id := range matched {
+		nIDs = append(nIDs, id)
+	}
+
+	sort.Slice(nIDs, func(i, j int) bool {
+		if scores[nIDs[i]] != scores[nIDs[j]] {
+			return scores[nIDs[i]] > scores[nIDs[j]]
+		}
+		return nIDs[i] < nIDs[j]
+	})
+
+	for _, id := range nIDs {
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+
+end:
+	if err != nil {
+		debugPrintf("TextSearch() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// isPositiveTerm checks if the term is used without NOT in the clauses.
+func isPositiveTerm(clauses [][]textTerm, key textTerm) bool {
+	for _, clause := range clauses {
+		for _, t := range clause {
+			if !t.not && t.term == key.term && t.prefix == key.prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RebuildTextIndex deletes the inverted index and indexes all records again.
+// It should be called after text search mode is enabled for a database which has records,
+// or to remove unused terms. Other clients should not write records during rebuilding.
+//
+//	Returns:
+//	    n: number of indexed records.
+func (db *DB) RebuildTextIndex() (n uint64, err error) {
+	textKeyPrefix := fmt.Sprintf("%v/text/", db.name)
+
+	if err = db.checkSearch(); err != nil {
+		goto end
+	}
+
+	if err = scanDBKeys(db.c, db.name, func(keys []string) error {
+		textKeys := []string{}
+		for _, k := range keys {
+			if strings.HasPrefix(k, textKeyPrefix) {
+				textKeys = append(textKeys, k)
+			}
+		}
+
+		if len(textKeys) == 0 {
+			return nil
+		}
+		return unlinkKeys(db.c, textKeys)
+	}); err != nil {
+		goto end
+	}
+
+	if err = db.forEachRecord(func(id uint64, data string) error {
+		for term := range textTerms(data) {
+			db.c.Send("SADD", db.genTextTermKey(term), id)
+			db.c.Send("ZADD", db.genTextTermsKey(), 0, term)
+		}
+
+		if _, err := db.c.Do(""); err != nil {
+			return err
+		}
+		n++
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+	debugPrintf("RebuildTextIndex() ok. n: %v\n", n)
+
+end:
+	if err != nil {
+		debugPrintf("RebuildTextIndex() error: %v\n", err)
+		return 0, err
+	}
+
+	return n, nil
+}
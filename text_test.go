@@ -0,0 +1,52 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_TextSearch() {
+	var err error
+	var db *simpledb.DB
+	var ids, matched []string
+
+	log.Printf("\n")
+	log.Printf("--------- TextSearch() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "text-test")
+	defer db.Close()
+
+	db.SetTextSearch(true)
+
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Frank Xu","tel":"13700137000","city":"Shanghai"}`,
+		`{"name":"Frank Wang","tel":"13600136000","city":"Beijing"}`,
+		`{"name":"Fred Smith","tel":"13500135000","city":"Shanghai"}`,
+	}); err != nil {
+		goto end
+	}
+
+	// Records which contain terms starting with "fr" and "shanghai", or "beijing".
+	if matched, err = db.TextSearch("fr* shanghai OR beijing"); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	// Records which contain "frank" but not "wang".
+	if matched, err = db.TextSearch("frank -wang"); err != nil {
+		goto end
+	}
+	log.Printf("matched: %v\n", matched)
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- TextSearch() Test End --------\n")
+	// Output:
+}
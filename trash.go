@@ -0,0 +1,300 @@
+package simpledb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// TrashedRecord is a record in the trash.
+type TrashedRecord struct {
+	Record
+	// DeletedAt is the time when the record is deleted.
+	DeletedAt time.Time
+}
+
+// SetSoftDelete sets soft-delete mode.
+// In soft-delete mode, Delete(), BatchDelete() and BatchDeletePartial() move records to the trash
+// instead of deleting them permanently. Records in the trash are excluded from Get(), Search() and Count().
+// They can be listed by ListTrash(), restored by Restore() or purged by PurgeTrash().
+// Deleting a record fails if its id is already in the trash(the id is recreated after it's deleted), so that trashed data is never overwritten.
+func (db *DB) SetSoftDelete(on bool) {
+	db.softDelete = on
+}
+
+// genTrashHashKey generates the trash hash(bucket) key by given record id.
+// Trashed records are stored in buckets which have the same bucket id as the record buckets.
+func (db *DB) genTrashHashKey(id uint64) string {
+	bucketID := db.computeBucketID(id)
+	return fmt.Sprintf("%v/trash/bucket/%v", db.name, bucketID)
+}
+
+// genTrashTimeKey generates the key of the deletion time of trashed records.
+// It's a sorted set. Member: record id, score: deletion time in Unix milliseconds.
+func (db *DB) genTrashTimeKey() string {
+	return fmt.Sprintf("%v/trash/time", db.name)
+}
+
+// queueTrash queues the commands to move a deleted record to the trash in the transaction.
+func (db *DB) queueTrash(t *tx, id uint64, data string) (err error) {
+	if err = db.queueSetValue(t, db.genTrashHashKey(id), id, db.genTrashOverflowKey(id), data); err != nil {
+		return err
+	}
+
+	t.send("ZADD", db.genTrashTimeKey(), time.Now().UnixMilli(), id)
+	return nil
+}
+
+// checkTrashFree returns an item error if the id is already in the trash.
+// It happens when the id is recreated(Ex: Upsert(), Revert() or CreateWithID()) while its old record is in the trash.
+// The trash entry is watched so that it's not overwritten by deleting the record again.
+func (db *DB) checkTrashFree(id uint64) (itemErr, err error) {
+	var exists bool
+
+	if err = db.watch(db.genTrashHashKey(id)); err != nil {
+		return nil, err
+	}
+
+	if _, exists, err = db.getTrashedData(id); err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return fmt.Errorf("Id: %v is already in the trash. Restore or purge it first.", id), nil
+	}
+	return nil, nil
+}
+
+// queueUntrash queues the commands to remove a record from the trash in the transaction.
+func (db *DB) queueUntrash(t *tx, id uint64) {
+	t.send("HDEL", db.genTrashHashKey(id), id)
+	t.send("DEL", db.genTrashOverflowKey(id))
+	t.send("ZREM", db.genTrashTimeKey(), id)
+}
+
+// getTrashedData gets the data of given trashed record id.
+// It returns false if the record is not in the trash.
+func (db *DB) getTrashedData(id uint64) (data string, exists bool, err error) {
+	if data, err = redis.String(db.c.Do("HGET", db.genTrashHashKey(id), id)); err != nil {
+		if err == redis.ErrNil {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if data, err = db.decodeData(data); err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+// ListTrash returns the records in the trash ordered by deletion time.
+func (db *DB) ListTrash() (records []TrashedRecord, err error) {
+	var items []string
+	var nID uint64
+	var deletedAt int64
+	var data string
+	var exists bool
+
+	records = []TrashedRecord{}
+
+	if items, err = redis.Strings(db.c.Do("ZRANGE", db.genTrashTimeKey(), 0, -1, "WITHSCORES")); err != nil {
+		goto end
+	}
+
+	for i := 1; i < len(items); i += 2 {
+		if nID, err = strconv.ParseUint(items[i-1], 10, 64); err != nil {
+			goto end
+		}
+
+		if deletedAt, err = strconv.ParseInt(items[i], 10, 64); err != nil {
+			goto end
+		}
+
+		if data, exists, err = db.getTrashedData(nID); err != nil {
+			goto end
+		}
+
+		if !exists {
+			continue
+		}
+
+		records = append(records, TrashedRecord{
+			Record:    Record{ID: items[i-1], Data: data},
+			DeletedAt: time.UnixMilli(deletedAt),
+		})
+	}
+
+end:
+	if err != nil {
+		debugPrintf("ListTrash() error: %v\n", err)
+		return []TrashedRecord{}, err
+	}
+
+	return records, nil
+}
+
+// Restore restores the record from the trash.
+func (db *DB) Restore(id string) (err error) {
+	if err = db.restore(OpRestore, []string{id}); err != nil {
+		debugPrintf("Restore() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// BatchRestore restores multiple records from the trash in one transaction.
+// It fails if any record is not in the trash, the id is used by another record,
+// or the data is already owned by another record(*DataExistsError).
+func (db *DB) BatchRestore(ids []string) (err error) {
+	if err = db.restore(OpBatchRestore, ids); err != nil {
+		debugPrintf("BatchRestore() error: %v\n", err)
+		return err
+	}
+
+	debugPrintf("BatchRestore() ok. ids: %v\n", ids)
+	return nil
+}
+
+// batchRestore restores multiple records from the trash in one transaction.
+func (db *DB) batchRestore(ids []string) (err error) {
+	keys := []string{db.genMetaKey(), db.genTrashTimeKey()}
+
+	nIDs, idErrs := parseIDs(ids)
+	for i := range ids {
+		if idErrs[i] != nil {
+			err = idErrs[i]
+			goto end
+		}
+		keys = append(keys, db.genTrashHashKey(nIDs[i]), db.genRecordHashKey(nIDs[i]))
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var data string
+		var owner, maxBucketID, newMaxBucketID uint64
+		var exists, found, ok bool
+		var err error
+		checkedIDs := make(map[uint64]int)  // key: id, value: order in ids.
+		checkedData := make(map[string]int) // key: data, value: order in ids.
+
+		// Max bucket id may be shrunk by Compact() after the records are deleted.
+		if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+		newMaxBucketID = maxBucketID
+
+		for i, id := range ids {
+			if _, ok = checkedIDs[nIDs[i]]; ok {
+				return fmt.Errorf("Redundant id found in ids: %v", id)
+			}
+			checkedIDs[nIDs[i]] = i
+
+			if data, exists, err = db.getTrashedData(nIDs[i]); err != nil {
+				return err
+			}
+
+			if !exists {
+				return fmt.Errorf("Id: %v is not in the trash.", id)
+			}
+
+			if err = db.checkDataSize(i, data); err != nil {
+				return err
+			}
+
+			if _, exists, err = db.getRecordData(nIDs[i]); err != nil {
+				return err
+			}
+
+			if exists {
+				return fmt.Errorf("Id: %v is used by another record.", id)
+			}
+
+			if _, ok = checkedData[data]; ok {
+				return fmt.Errorf("Redundant data found in trashed records: %v", data)
+			}
+			checkedData[data] = i
+
+			// Watch the index bucket which will be updated.
+			if err = db.watch(db.genIndexHashKey(data)); err != nil {
+				return err
+			}
+
+			if owner, found, err = db.getIndexedID(data); err != nil {
+				return err
+			}
+
+			if found {
+				return &DataExistsError{Data: data, ID: strconv.FormatUint(owner, 10)}
+			}
+
+			if err = db.queueCreate(t, nIDs[i], data); err != nil {
+				return err
+			}
+			db.queueUntrash(t, nIDs[i])
+
+			if bucketID := db.computeBucketID(nIDs[i]); bucketID > newMaxBucketID {
+				newMaxBucketID = bucketID
+			}
+		}
+
+		if newMaxBucketID > maxBucketID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxBucketID, newMaxBucketID)
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchRestore() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// PurgeTrash deletes the records in the trash permanently which are deleted before the retention period.
+//
+//	Params:
+//	    retention: retention period. All records in the trash are purged if it's 0.
+//	Returns:
+//	    ids: purged record ids.
+func (db *DB) PurgeTrash(retention time.Duration) (ids []string, err error) {
+	var nID uint64
+	k := db.genTrashTimeKey()
+	max := time.Now().Add(-retention).UnixMilli()
+	ids = []string{}
+
+	if _, err = db.doTx([]string{k}, func(t *tx) error {
+		var err error
+
+		if ids, err = redis.Strings(db.c.Do("ZRANGEBYSCORE", k, "-inf", max)); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+				return err
+			}
+			db.queueUntrash(t, nID)
+		}
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+	debugPrintf("PurgeTrash() ok. ids: %v\n", ids)
+
+end:
+	if err != nil {
+		debugPrintf("PurgeTrash() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,134 @@
+package simpledb_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetSoftDelete() {
+	var err error
+	var db *simpledb.DB
+	var count uint64
+	id := ""
+	ids := []string{}
+	trashed := []simpledb.TrashedRecord{}
+
+	log.Printf("\n")
+	log.Printf("--------- SetSoftDelete() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "trash-test")
+	defer db.Close()
+
+	db.SetSoftDelete(true)
+
+	if id, err = db.Create(`{"name":"Paul","tel":"13900139051"}`); err != nil {
+		goto end
+	}
+
+	// Move the record to the trash.
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	if count, err = db.Count(); err != nil {
+		goto end
+	}
+	log.Printf("record count after soft delete: %v\n", count)
+
+	if trashed, err = db.ListTrash(); err != nil {
+		goto end
+	}
+
+	for _, r := range trashed {
+		log.Printf("trash: id: %v, data: %v, deleted at: %v\n", r.ID, r.Data, r.DeletedAt)
+	}
+
+	if err = db.Restore(id); err != nil {
+		goto end
+	}
+
+	if count, err = db.Count(); err != nil {
+		goto end
+	}
+	log.Printf("record count after restore: %v\n", count)
+
+	// Delete the record and purge the trash.
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	if ids, err = db.PurgeTrash(0); err != nil {
+		goto end
+	}
+	log.Printf("purged ids: %v\n", ids)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetSoftDelete() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_Restore() {
+	var err error
+	var db *simpledb.DB
+	var ids []string
+	var count uint64
+	var result simpledb.CompactResult
+	dataArr := []string{}
+
+	log.Printf("\n")
+	log.Printf("--------- Restore() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "restore-test")
+	defer db.Close()
+
+	db.SetSoftDelete(true)
+
+	for i := 0; i < 2000; i++ {
+		dataArr = append(dataArr, fmt.Sprintf(`{"name":"user%v"}`, i))
+	}
+
+	if ids, err = db.BatchCreate(dataArr); err != nil {
+		goto end
+	}
+
+	// Move most records to the trash and compact the buckets.
+	if err = db.BatchDelete(ids[10:]); err != nil {
+		goto end
+	}
+
+	if result, err = db.Compact(); err != nil {
+		goto end
+	}
+	log.Printf("max bucket id: %v -> %v\n", result.OldMaxBucketID, result.NewMaxBucketID)
+
+	// Restore the last record. It's counted again.
+	if err = db.Restore(ids[len(ids)-1]); err != nil {
+		goto end
+	}
+
+	if count, err = db.Count(); err != nil {
+		goto end
+	}
+	log.Printf("record count after restore: %v\n", count)
+
+	// Delete all records and purge the trash.
+	if err = db.BatchDelete(append(append([]string{}, ids[:10]...), ids[len(ids)-1])); err != nil {
+		goto end
+	}
+
+	if _, err = db.PurgeTrash(0); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Restore() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,143 @@
+package simpledb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// TruncateLockTimeout is the expiration time of the truncation lock.
+	// The lock is refreshed after each batch of keys is deleted.
+	TruncateLockTimeout = 60 * time.Second
+)
+
+var (
+	// releaseTruncateLockScript deletes the truncation lock only if it's owned by the token.
+	releaseTruncateLockScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+	// refreshTruncateLockScript resets the expiration time of the truncation lock only if it's owned by the token.
+	refreshTruncateLockScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+)
+
+// genTruncateLockKey generates the key of the truncation lock.
+func (db *DB) genTruncateLockKey() string {
+	return fmt.Sprintf("%v/truncating", db.name)
+}
+
+// checkTruncateLock returns ErrTruncating if the database is being truncated.
+func (db *DB) checkTruncateLock() (err error) {
+	exists := false
+
+	if exists, err = redis.Bool(db.c.Do("EXISTS", db.genTruncateLockKey())); err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrTruncating
+	}
+	return nil
+}
+
+// isConfigKey checks if the key stores the configuration of the database which is kept by Truncate().
+func (db *DB) isConfigKey(k string) bool {
+	switch k {
+	case db.genMetaKey(), db.genChangeFeedKey(), db.genTruncateLockKey():
+		return true
+	}
+	return false
+}
+
+// refreshTruncateLock resets the expiration time of the truncation lock owned by the token.
+// It returns an error if the lock is expired and may be acquired by another Truncate().
+func (db *DB) refreshTruncateLock(token string) (err error) {
+	var n int64
+
+	if n, err = redis.Int64(refreshTruncateLockScript.Do(db.c, db.genTruncateLockKey(), token, TruncateLockTimeout.Milliseconds())); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("Truncation lock is lost: it's expired after %v.", TruncateLockTimeout)
+	}
+	return nil
+}
+
+// Truncate deletes all records of the database while keeping its configuration(bucket size, change feed and consumer groups).
+// Record buckets, index buckets, versions, expiry schedule, trash and history are deleted in batches(UNLINK where available),
+// and max id / max bucket id are reset.
+// Write operations from other clients fail with ErrTruncating during truncation.
+// The lock stores a random token so that only the owner refreshes and releases it.
+func (db *DB) Truncate() (err error) {
+	var ok string
+	lockKey := db.genTruncateLockKey()
+	locked := false
+	buf := make([]byte, 16)
+	token := ""
+
+	if _, err = rand.Read(buf); err != nil {
+		goto end
+	}
+	token = hex.EncodeToString(buf)
+
+	// Acquire the lock. Transactions of concurrent writers which watch the lock are aborted.
+	if ok, err = redis.String(db.c.Do("SET", lockKey, token, "NX", "PX", TruncateLockTimeout.Milliseconds())); err != nil {
+		if err == redis.ErrNil {
+			err = ErrTruncating
+		}
+		goto end
+	}
+
+	if ok != "OK" {
+		err = ErrTruncating
+		goto end
+	}
+	locked = true
+
+	if err = scanDBKeys(db.c, db.name, func(keys []string) error {
+		dataKeys := []string{}
+
+		for _, k := range keys {
+			if !db.isConfigKey(k) {
+				dataKeys = append(dataKeys, k)
+			}
+		}
+
+		if len(dataKeys) > 0 {
+			if err := unlinkKeys(db.c, dataKeys); err != nil {
+				return err
+			}
+		}
+
+		return db.refreshTruncateLock(token)
+	}); err != nil {
+		goto end
+	}
+
+	// Make sure the lock is still owned before resetting the meta data.
+	if err = db.refreshTruncateLock(token); err != nil {
+		goto end
+	}
+
+	// Reset max id and max bucket id in the meta hash.
+	if _, err = db.c.Do("HDEL", db.genMetaKey(), metaFieldMaxID, metaFieldMaxBucketID); err != nil {
+		goto end
+	}
+
+	debugPrintf("Truncate() ok. name: %v\n", db.name)
+
+end:
+	// Do not delete the lock acquired by another Truncate() after this one is expired.
+	if locked {
+		releaseTruncateLockScript.Do(db.c, lockKey, token)
+	}
+
+	if err != nil {
+		debugPrintf("Truncate() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Truncate() {
+	var err error
+	var db *simpledb.DB
+	var count, maxID uint64
+
+	log.Printf("\n")
+	log.Printf("--------- Truncate() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "truncate-test")
+	defer db.Close()
+
+	if _, err = db.BatchCreate([]string{
+		`{"name":"Xena","tel":"13900139101"}`,
+		`{"name":"Yuri","tel":"13900139102"}`,
+	}); err != nil {
+		goto end
+	}
+
+	if err = db.Truncate(); err != nil {
+		goto end
+	}
+
+	if count, err = db.Count(); err != nil {
+		goto end
+	}
+
+	if maxID, err = db.GetMaxID(); err != nil {
+		goto end
+	}
+	log.Printf("after truncate: count: %v, max id: %v\n", count, maxID)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Truncate() Test End --------\n")
+	// Output:
+}
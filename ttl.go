@@ -0,0 +1,301 @@
+package simpledb
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// ReapBatchSize is the max number of expired records deleted in one transaction by ReapExpired().
+	ReapBatchSize = 1024
+)
+
+// genExpiryKey generates the key of the expiry schedule.
+// It's a sorted set. Member: record id, score: expiration time in Unix milliseconds.
+func (db *DB) genExpiryKey() string {
+	return fmt.Sprintf("%v/expiry", db.name)
+}
+
+// queueExpire queues the command to set the expiration time of a record in the transaction.
+func (db *DB) queueExpire(t *tx, id uint64, ttl time.Duration) {
+	t.send("ZADD", db.genExpiryKey(), time.Now().Add(ttl).UnixMilli(), id)
+}
+
+// CreateWithTTL creates a new record which expires after ttl.
+// Expired records are deleted by ReapExpired() or the reaper started by StartReaper().
+func (db *DB) CreateWithTTL(data string, ttl time.Duration) (id string, err error) {
+	ids := []string{}
+
+	if ids, err = db.createWithTTL(OpCreate, []string{data}, ttl); err != nil {
+		goto end
+	}
+
+	if len(ids) != 1 {
+		err = fmt.Errorf("Count of created record != 1.")
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("CreateWithTTL() error: %v\n", err)
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+// BatchCreateWithTTL creates records which expire after ttl in one transaction.
+func (db *DB) BatchCreateWithTTL(dataArr []string, ttl time.Duration) (ids []string, err error) {
+	if ids, err = db.createWithTTL(OpBatchCreate, dataArr, ttl); err != nil {
+		debugPrintf("BatchCreateWithTTL() error: %v\n", err)
+		return []string{}, err
+	}
+
+	debugPrintf("BatchCreateWithTTL() ok. ids: %v, ttl: %v\n", ids, ttl)
+	return ids, nil
+}
+
+// createWithTTL creates records which expire after ttl in one transaction with hooks of op.
+func (db *DB) createWithTTL(op Operation, dataArr []string, ttl time.Duration) (ids []string, err error) {
+	var results []ItemResult
+
+	if ttl <= 0 {
+		return []string{}, fmt.Errorf("Invalid ttl: %v.", ttl)
+	}
+
+	if results, err = db.create(op, dataRecords(dataArr), false, ttl); err != nil {
+		return []string{}, err
+	}
+	return resultIDs(results), nil
+}
+
+// Expire sets the record to expire after ttl. It replaces the previous expiration time of the record.
+func (db *DB) Expire(id string, ttl time.Duration) (err error) {
+	var nID uint64
+
+	if ttl <= 0 {
+		err = fmt.Errorf("Invalid ttl: %v.", ttl)
+		goto end
+	}
+
+	if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		goto end
+	}
+
+	if _, err = db.doTx([]string{db.genRecordHashKey(nID)}, func(t *tx) error {
+		_, exists, err := db.getRecordData(nID)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return fmt.Errorf("Id: %v does not exist.", id)
+		}
+
+		db.queueExpire(t, nID, ttl)
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Expire() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// Persist removes the expiration time of the record.
+func (db *DB) Persist(id string) (err error) {
+	var nID uint64
+
+	if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		goto end
+	}
+
+	if _, err = db.c.Do("ZREM", db.genExpiryKey(), nID); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Persist() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// TTL returns the remaining time to live of the record.
+//
+//	Returns:
+//	    ttl: remaining time to live. It's negative if the record is expired but not reaped yet.
+//	    ok: false if the record has no expiration time.
+func (db *DB) TTL(id string) (ttl time.Duration, ok bool, err error) {
+	var nID uint64
+	var expireAt int64
+
+	if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		goto end
+	}
+
+	if expireAt, err = redis.Int64(db.c.Do("ZSCORE", db.genExpiryKey(), nID)); err != nil {
+		if err == redis.ErrNil {
+			return 0, false, nil
+		}
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("TTL() error: %v\n", err)
+		return 0, false, err
+	}
+
+	return time.Until(time.UnixMilli(expireAt)), true, nil
+}
+
+// ReapExpired deletes expired records together with their index entries.
+//
+//	Returns:
+//	    ids: deleted record ids.
+func (db *DB) ReapExpired() (ids []string, err error) {
+	var now int64
+	var results []ItemResult
+	exists := false
+	expiredIDs := []string{}
+	k := db.genExpiryKey()
+	ids = []string{}
+
+	for {
+		now = time.Now().UnixMilli()
+		if expiredIDs, err = redis.Strings(db.c.Do("ZRANGEBYSCORE", k, "-inf", now, "LIMIT", 0, ReapBatchSize)); err != nil {
+			goto end
+		}
+
+		if len(expiredIDs) == 0 {
+			break
+		}
+
+		// Check the expiration time again in the transaction in case that it's changed by Expire().
+		if results, err = db.delete(OpReapExpired, expiredIDs, true, false, func(id uint64, data string) error {
+			if err := db.watch(k); err != nil {
+				return err
+			}
+
+			expireAt, err := redis.Int64(db.c.Do("ZSCORE", k, id))
+			if err != nil {
+				if err == redis.ErrNil {
+					return fmt.Errorf("Id: %v does not expire.", id)
+				}
+				return err
+			}
+
+			if expireAt > now {
+				return fmt.Errorf("Id: %v is not expired.", id)
+			}
+			return nil
+		}); err != nil {
+			goto end
+		}
+
+		for _, r := range results {
+			if r.Status == ItemCommitted {
+				ids = append(ids, r.ID)
+				continue
+			}
+
+			// Remove the schedule of the record which is already deleted.
+			if exists, err = db.IDExists(r.ID); err != nil {
+				goto end
+			}
+
+			if !exists {
+				if _, err = db.c.Do("ZREM", k, r.ID); err != nil {
+					goto end
+				}
+			}
+		}
+
+		if len(expiredIDs) < ReapBatchSize {
+			break
+		}
+	}
+
+	debugPrintf("ReapExpired() ok. ids: %v\n", ids)
+
+end:
+	if err != nil {
+		debugPrintf("ReapExpired() error: %v\n", err)
+		return []string{}, err
+	}
+
+	return ids, nil
+}
+
+// StartReaper starts a background goroutine which calls ReapExpired() every interval with a new Redis connection.
+//
+//	Params:
+//	    interval: interval of calling ReapExpired(). It should be greater than 0.
+//	    onError: function called with the error returned by ReapExpired() in the goroutine.
+//	             Errors are ignored if it's nil. The reaper keeps running after errors.
+//	Returns:
+//	    stop: function to stop the reaper. It waits for the goroutine to exit and can be called more than once.
+//	          Close() stops all reapers started by the DB.
+func (db *DB) StartReaper(interval time.Duration, onError func(err error)) (stop func(), err error) {
+	var reaperDB *DB
+	var once sync.Once
+	quit := make(chan struct{})
+	done := make(chan struct{})
+
+	if interval <= 0 {
+		err = fmt.Errorf("Invalid reaper interval: %v.", interval)
+		goto end
+	}
+
+	if reaperDB, err = db.clone(); err != nil {
+		goto end
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer func() {
+			ticker.Stop()
+			reaperDB.Close()
+			close(done)
+		}()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := reaperDB.ReapExpired(); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-quit:
+				return
+			}
+		}
+	}()
+
+	stop = func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+		})
+	}
+	db.reaperStops = append(db.reaperStops, stop)
+
+end:
+	if err != nil {
+		debugPrintf("StartReaper() error: %v\n", err)
+		return nil, err
+	}
+
+	return stop, nil
+}
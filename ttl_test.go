@@ -0,0 +1,94 @@
+package simpledb_test
+
+import (
+	"log"
+	"time"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_CreateWithTTL() {
+	var err error
+	var db *simpledb.DB
+	var ttl time.Duration
+	id := ""
+	ok := false
+	ids := []string{}
+
+	log.Printf("\n")
+	log.Printf("--------- CreateWithTTL() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "ttl-test")
+	defer db.Close()
+
+	if id, err = db.CreateWithTTL(`{"name":"Nina","tel":"13900139041"}`, 100*time.Millisecond); err != nil {
+		goto end
+	}
+
+	if ttl, ok, err = db.TTL(id); err != nil {
+		goto end
+	}
+	log.Printf("id: %v, ttl: %v, ok: %v\n", id, ttl, ok)
+
+	time.Sleep(200 * time.Millisecond)
+
+	if ids, err = db.ReapExpired(); err != nil {
+		goto end
+	}
+	log.Printf("reaped ids: %v\n", ids)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- CreateWithTTL() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_StartReaper() {
+	var err error
+	var db *simpledb.DB
+	var stop func()
+	id := ""
+	exists := false
+
+	log.Printf("\n")
+	log.Printf("--------- StartReaper() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "ttl-test")
+	defer db.Close()
+
+	// Interval should be greater than 0.
+	if _, err = db.StartReaper(0, nil); err == nil {
+		log.Printf("StartReaper() should fail with 0 interval\n")
+	}
+
+	if stop, err = db.StartReaper(50*time.Millisecond, func(err error) {
+		log.Printf("reaper error: %v\n", err)
+	}); err != nil {
+		goto end
+	}
+	defer stop()
+
+	if id, err = db.Create(`{"name":"Owen","tel":"13900139042"}`); err != nil {
+		goto end
+	}
+
+	if err = db.Expire(id, 100*time.Millisecond); err != nil {
+		goto end
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if exists, err = db.IDExists(id); err != nil {
+		goto end
+	}
+	log.Printf("id: %v exists after expired: %v\n", id, exists)
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- StartReaper() Test End --------\n")
+	// Output:
+}
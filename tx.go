@@ -0,0 +1,183 @@
+package simpledb
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	// MaxTxRetries is the max retry times of an optimistic transaction which is aborted because watched keys are modified by other clients.
+	MaxTxRetries = 16
+)
+
+// txCmd is a Redis command queued in a transaction.
+type txCmd struct {
+	name string
+	args []interface{}
+}
+
+// tx collects the Redis commands which will be executed in MULTI / EXEC.
+type tx struct {
+	cmds []txCmd
+}
+
+// send queues a Redis command in the transaction.
+func (t *tx) send(name string, args ...interface{}) {
+	t.cmds = append(t.cmds, txCmd{name: name, args: args})
+}
+
+// watch watches the given keys before MULTI.
+func (db *DB) watch(keys ...string) (err error) {
+	args := []interface{}{}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for _, k := range keys {
+		args = append(args, k)
+	}
+
+	_, err = db.c.Do("WATCH", args...)
+	return err
+}
+
+// doTx runs an optimistic transaction based on WATCH / MULTI / EXEC.
+//
+//	Params:
+//	    keys: keys to watch before prepare is called. The truncation lock is always watched.
+//	    prepare: it reads and checks current values, watches more keys by db.watch() if need,
+//	             and queues the commands to be executed in MULTI / EXEC.
+//	             Non-nil error returned by prepare stops the transaction.
+//	Returns:
+//	    ret: replies of the queued commands.
+//
+// The transaction is retried(prepare is called again) if any watched key is modified before EXEC.
+func (db *DB) doTx(keys []string, prepare func(t *tx) error) (ret []interface{}, err error) {
+	var reply interface{}
+	var t *tx
+	alreadySendMULTI := false
+
+	for i := 0; i < MaxTxRetries; i++ {
+		t = &tx{}
+		alreadySendMULTI = false
+
+		// Watch the truncation lock to abort writes when Truncate() starts.
+		// Build a new slice so that the caller's keys are never modified by append.
+		if err = db.watch(append(append([]string{}, keys...), db.genTruncateLockKey())...); err != nil {
+			goto end
+		}
+
+		if err = db.checkTruncateLock(); err != nil {
+			goto end
+		}
+
+		if err = prepare(t); err != nil {
+			goto end
+		}
+
+		db.c.Send("MULTI")
+		alreadySendMULTI = true
+
+		for _, cmd := range t.cmds {
+			db.c.Send(cmd.name, cmd.args...)
+		}
+
+		if reply, err = db.c.Do("EXEC"); err != nil {
+			goto end
+		}
+		alreadySendMULTI = false
+
+		// EXEC returns nil reply if the transaction is aborted by WATCH.
+		if reply != nil {
+			ret, err = redis.Values(reply, nil)
+			goto end
+		}
+
+		debugPrintf("doTx() aborted by modified watched keys, retry: %v\n", i+1)
+	}
+
+	err = fmt.Errorf("Transaction aborted %v times by modified watched keys.", MaxTxRetries)
+
+end:
+	if err != nil {
+		if alreadySendMULTI {
+			db.c.Do("DISCARD")
+		} else {
+			db.c.Do("UNWATCH")
+		}
+		debugPrintf("doTx() error: %v\n", err)
+		return []interface{}{}, err
+	}
+
+	return ret, nil
+}
+
+// getUint64 gets the uint64 value of given key. It returns defaultValue if the key does not exist.
+// It's used to read counters in a transaction without writing the watched keys.
+func (db *DB) getUint64(k string, defaultValue uint64) (n uint64, err error) {
+	if n, err = redis.Uint64(db.c.Do("GET", k)); err != nil {
+		if err == redis.ErrNil {
+			return defaultValue, nil
+		}
+		return 0, err
+	}
+	return n, nil
+}
+
+// queueCreate queues the commands to create a record in the transaction.
+func (db *DB) queueCreate(t *tx, id uint64, data string) (err error) {
+	if err = db.queueSetValue(t, db.genRecordHashKey(id), id, db.genOverflowKey(id), data); err != nil {
+		return err
+	}
+
+	t.send("HSET", db.genIndexHashKey(data), db.genIndexHashField(data), id)
+	t.send("HSET", db.genVersionHashKey(id), id, 1)
+	db.queueTextIndex(t, id, "", data)
+	db.queueFieldIndexes(t, id, "", data)
+	return db.queueChange(t, ChangeCreate, id, "", data)
+}
+
+// queueUpdate queues the commands to replace the data of an existing record in the transaction.
+// It's a no-op if the data is not changed.
+// It should be called in prepare of doTx() because it may read and watch keys.
+func (db *DB) queueUpdate(t *tx, id uint64, oldData, data string) (err error) {
+	if oldData == data {
+		return nil
+	}
+
+	if err = db.queueHistory(t, id, oldData); err != nil {
+		return err
+	}
+
+	// Delete the old overflow value. It's set again if the new value is still too long.
+	t.send("DEL", db.genOverflowKey(id))
+	if err = db.queueSetValue(t, db.genRecordHashKey(id), id, db.genOverflowKey(id), data); err != nil {
+		return err
+	}
+
+	t.send("HDEL", db.genIndexHashKey(oldData), db.genIndexHashField(oldData))
+	t.send("HSET", db.genIndexHashKey(data), db.genIndexHashField(data), id)
+	t.send("HINCRBY", db.genVersionHashKey(id), id, 1)
+	db.queueTextIndex(t, id, oldData, data)
+	db.queueFieldIndexes(t, id, oldData, data)
+	return db.queueChange(t, ChangeUpdate, id, oldData, data)
+}
+
+// queueDelete queues the commands to delete a record in the transaction.
+// It should be called in prepare of doTx() because it may read and watch keys.
+func (db *DB) queueDelete(t *tx, id uint64, data string) (err error) {
+	if err = db.queueHistory(t, id, data); err != nil {
+		return err
+	}
+
+	t.send("HDEL", db.genRecordHashKey(id), id)
+	t.send("DEL", db.genOverflowKey(id))
+	t.send("HDEL", db.genIndexHashKey(data), db.genIndexHashField(data))
+	t.send("HDEL", db.genVersionHashKey(id), id)
+	t.send("ZREM", db.genExpiryKey(), id)
+	db.queueTextIndex(t, id, data, "")
+	db.queueFieldIndexes(t, id, data, "")
+	return db.queueChange(t, ChangeDelete, id, data, "")
+}
@@ -0,0 +1,362 @@
+package simpledb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// UpsertResult is the result of each item of BatchUpsert() and BatchCreateOrGet().
+type UpsertResult struct {
+	// ID is record ID.
+	ID string
+	// Created is true if the record is created.
+	// It's false if the record is replaced(BatchUpsert) or found(BatchCreateOrGet).
+	Created bool
+}
+
+// getRecordData gets the stored data of given record id in a transaction.
+// It returns false if the record does not exist.
+func (db *DB) getRecordData(id uint64) (data string, exists bool, err error) {
+	if data, err = redis.String(db.c.Do("HGET", db.genRecordHashKey(id), id)); err != nil {
+		if err == redis.ErrNil {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if data, err = db.decodeData(data); err != nil {
+		return "", false, err
+	}
+	return data, true, nil
+}
+
+// getIndexedID gets the record id which owns given data in a transaction.
+// It returns false if the data does not exist.
+func (db *DB) getIndexedID(data string) (id uint64, exists bool, err error) {
+	if err = db.checkEncryption(); err != nil {
+		return 0, false, err
+	}
+
+	if id, err = redis.Uint64(db.c.Do("HGET", db.genIndexHashKey(data), db.genIndexHashField(data))); err != nil {
+		if err == redis.ErrNil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// Upsert creates the record with given ID or replaces the data of the record if it already exists.
+//
+//	Returns:
+//	    created: true if the record is created, false if it's replaced.
+func (db *DB) Upsert(record Record) (created bool, err error) {
+	results := []UpsertResult{}
+
+	if results, err = db.upsert(OpUpsert, []Record{record}); err != nil {
+		goto end
+	}
+
+	if len(results) != 1 {
+		err = fmt.Errorf("Count of upserted record != 1.")
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Upsert() error: %v\n", err)
+		return false, err
+	}
+
+	return results[0].Created, nil
+}
+
+// BatchUpsert creates or replaces multiple records atomically.
+//
+//	Params:
+//	    records: records to create or replace. ID of each record should be a positive integer.
+//	             It should not be greater than max id + MaxIDGap in sequential bucket mapping.
+//	Returns:
+//	    results: each result contains the record ID and whether the record is created or replaced.
+//
+// It fails if the data of one record is already owned by another record.
+func (db *DB) BatchUpsert(records []Record) (results []UpsertResult, err error) {
+	if results, err = db.upsert(OpBatchUpsert, records); err != nil {
+		debugPrintf("BatchUpsert() error: %v\n", err)
+		return []UpsertResult{}, err
+	}
+
+	debugPrintf("BatchUpsert() ok. results: %v\n", results)
+	return results, nil
+}
+
+// batchUpsert creates or replaces multiple records in one transaction.
+func (db *DB) batchUpsert(records []Record) (results []UpsertResult, err error) {
+	var nIDs []uint64
+	var nID uint64
+	checkedIDs := make(map[uint64]int)  // key: id, value: order in records.
+	checkedData := make(map[string]int) // key: data, value: order in records.
+	keys := []string{db.genMetaKey()}
+	ok := false
+
+	// Check records.
+	for i, r := range records {
+		if len(r.Data) == 0 {
+			err = fmt.Errorf("Empty data.")
+			goto end
+		}
+
+		if err = db.checkDataSize(i, r.Data); err != nil {
+			goto end
+		}
+
+		if err = db.validate(i, r.Data); err != nil {
+			goto end
+		}
+
+		if nID, err = strconv.ParseUint(r.ID, 10, 64); err != nil {
+			goto end
+		}
+
+		if nID == 0 {
+			err = fmt.Errorf("Invalid id: %v.", r.ID)
+			goto end
+		}
+
+		if _, ok = checkedIDs[nID]; ok {
+			err = fmt.Errorf("Redundant id found in records: %v", r.ID)
+			goto end
+		}
+		checkedIDs[nID] = i
+
+		if _, ok = checkedData[r.Data]; ok {
+			err = fmt.Errorf("Redundant data found in records: %v", r.Data)
+			goto end
+		}
+		checkedData[r.Data] = i
+
+		nIDs = append(nIDs, nID)
+		keys = append(keys, db.genRecordHashKey(nID), db.genIndexHashKey(r.Data))
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var maxID, maxBucketID, newMaxID, newMaxBucketID, owner uint64
+		var oldData string
+		var exists, found bool
+		var err error
+
+		results = []UpsertResult{}
+
+		if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
+			return err
+		}
+
+		if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+
+		newMaxID, newMaxBucketID = maxID, maxBucketID
+
+		for i, r := range records {
+			if err = db.checkIDGap(nIDs[i], newMaxID); err != nil {
+				return err
+			}
+
+			if oldData, exists, err = db.getRecordData(nIDs[i]); err != nil {
+				return err
+			}
+
+			if owner, found, err = db.getIndexedID(r.Data); err != nil {
+				return err
+			}
+
+			if found && owner != nIDs[i] {
+				return &DataExistsError{Data: r.Data, ID: strconv.FormatUint(owner, 10)}
+			}
+
+			if exists {
+				// Watch the index bucket of old data which will be updated.
+				if err = db.watch(db.genIndexHashKey(oldData)); err != nil {
+					return err
+				}
+				if err = db.queueUpdate(t, nIDs[i], oldData, r.Data); err != nil {
+					return err
+				}
+			} else {
+				if err = db.queueCreate(t, nIDs[i], r.Data); err != nil {
+					return err
+				}
+			}
+
+			if nIDs[i] > newMaxID {
+				newMaxID = nIDs[i]
+			}
+
+			if bucketID := db.computeBucketID(nIDs[i]); bucketID > newMaxBucketID {
+				newMaxBucketID = bucketID
+			}
+
+			results = append(results, UpsertResult{ID: r.ID, Created: !exists})
+		}
+
+		if newMaxID > maxID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxID, newMaxID)
+		}
+
+		if newMaxBucketID > maxBucketID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxBucketID, newMaxBucketID)
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchUpsert() error: %v\n", err)
+		return []UpsertResult{}, err
+	}
+
+	return results, nil
+}
+
+// CreateOrGet creates a new record with given data or returns the ID of the existing record which has the same data.
+//
+//	Returns:
+//	    id: record ID.
+//	    created: true if the record is created, false if it already exists.
+func (db *DB) CreateOrGet(data string) (id string, created bool, err error) {
+	results := []UpsertResult{}
+
+	if results, err = db.createOrGet(OpCreateOrGet, []string{data}); err != nil {
+		goto end
+	}
+
+	if len(results) != 1 {
+		err = fmt.Errorf("Count of created or found record != 1.")
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("CreateOrGet() error: %v\n", err)
+		return "", false, err
+	}
+
+	return results[0].ID, results[0].Created, nil
+}
+
+// BatchCreateOrGet creates records for the data which do not exist and gets the IDs of the data which already exist atomically.
+//
+//	Params:
+//	    dataArr: record data array.
+//	Returns:
+//	    results: each result contains the record ID and whether the record is created or found.
+//	             The order is the same as dataArr. Redundant data in dataArr share the same ID.
+func (db *DB) BatchCreateOrGet(dataArr []string) (results []UpsertResult, err error) {
+	if results, err = db.createOrGet(OpBatchCreateOrGet, dataArr); err != nil {
+		debugPrintf("BatchCreateOrGet() error: %v\n", err)
+		return []UpsertResult{}, err
+	}
+
+	debugPrintf("BatchCreateOrGet() ok. results: %v\n", results)
+	return results, nil
+}
+
+// batchCreateOrGet creates records for the data which do not exist and gets the IDs of existing data in one transaction.
+func (db *DB) batchCreateOrGet(dataArr []string) (results []UpsertResult, err error) {
+	keys := []string{db.genMetaKey()}
+
+	for i, data := range dataArr {
+		if len(data) == 0 {
+			err = fmt.Errorf("Empty data.")
+			goto end
+		}
+
+		if err = db.checkDataSize(i, data); err != nil {
+			goto end
+		}
+
+		if err = db.validate(i, data); err != nil {
+			goto end
+		}
+		keys = append(keys, db.genIndexHashKey(data))
+	}
+
+	if _, err = db.doTx(keys, func(t *tx) error {
+		var maxID, maxBucketID, newMaxBucketID, owner, nID uint64
+		var found, ok bool
+		var err, itemErr error
+		var i int
+		checkedData := make(map[string]int) // key: data, value: order in results.
+		usedIDs := make(map[uint64]struct{})
+
+		results = []UpsertResult{}
+
+		if maxID, err = db.getMetaUint64(metaFieldMaxID, 0); err != nil {
+			return err
+		}
+
+		if maxBucketID, err = db.getMetaUint64(metaFieldMaxBucketID, 1); err != nil {
+			return err
+		}
+
+		newMaxBucketID = maxBucketID
+
+		for _, data := range dataArr {
+			if i, ok = checkedData[data]; ok {
+				results = append(results, UpsertResult{ID: results[i].ID, Created: false})
+				continue
+			}
+			checkedData[data] = len(results)
+
+			if owner, found, err = db.getIndexedID(data); err != nil {
+				return err
+			}
+
+			if found {
+				results = append(results, UpsertResult{ID: strconv.FormatUint(owner, 10), Created: false})
+				continue
+			}
+
+			if nID, itemErr, err = db.nextID("", &maxID, usedIDs); err != nil {
+				return err
+			}
+
+			if itemErr != nil {
+				return itemErr
+			}
+
+			if err = db.queueCreate(t, nID, data); err != nil {
+				return err
+			}
+
+			if bucketID := db.computeBucketID(nID); bucketID > newMaxBucketID {
+				newMaxBucketID = bucketID
+			}
+
+			results = append(results, UpsertResult{ID: strconv.FormatUint(nID, 10), Created: true})
+		}
+
+		t.send("HSET", db.genMetaKey(), metaFieldMaxID, maxID)
+
+		if newMaxBucketID > maxBucketID {
+			t.send("HSET", db.genMetaKey(), metaFieldMaxBucketID, newMaxBucketID)
+		}
+
+		return nil
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("batchCreateOrGet() error: %v\n", err)
+		return []UpsertResult{}, err
+	}
+
+	return results, nil
+}
@@ -0,0 +1,104 @@
+package simpledb_test
+
+import (
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_BatchUpsert() {
+	var err error
+	var db *simpledb.DB
+	results := []simpledb.UpsertResult{}
+	records := []simpledb.Record{
+		{ID: "1", Data: `{"name":"Alice","tel":"13900139001"}`},
+		{ID: "100", Data: `{"name":"Ben","tel":"13900139002"}`},
+	}
+
+	log.Printf("\n")
+	log.Printf("--------- BatchUpsert() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "upsert-test")
+	defer db.Close()
+
+	// Create records with given IDs.
+	if results, err = db.BatchUpsert(records); err != nil {
+		goto end
+	}
+
+	for _, r := range results {
+		log.Printf("id: %v, created: %v\n", r.ID, r.Created)
+	}
+
+	// Replace the data of record 1.
+	records[0].Data = `{"name":"Alice","tel":"13900139003"}`
+	if results, err = db.BatchUpsert(records[:1]); err != nil {
+		goto end
+	}
+
+	log.Printf("id: %v, created: %v\n", results[0].ID, results[0].Created)
+
+	// Data owned by record 100 can not be used by record 1.
+	records[0].Data = records[1].Data
+	if _, err = db.Upsert(records[0]); err != nil {
+		log.Printf("Upsert() error as expected: %v\n", err)
+		err = nil
+	}
+
+	if err = db.BatchDelete([]string{"1", "100"}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- BatchUpsert() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_BatchCreateOrGet() {
+	var err error
+	var db *simpledb.DB
+	id := ""
+	created := false
+	ids := []string{}
+	results := []simpledb.UpsertResult{}
+	data := []string{
+		`{"name":"Carl","tel":"13900139004"}`,
+		`{"name":"Dora","tel":"13900139005"}`,
+		`{"name":"Carl","tel":"13900139004"}`,
+	}
+
+	log.Printf("\n")
+	log.Printf("--------- BatchCreateOrGet() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "upsert-test")
+	defer db.Close()
+
+	if id, created, err = db.CreateOrGet(data[0]); err != nil {
+		goto end
+	}
+	log.Printf("CreateOrGet(): id: %v, created: %v\n", id, created)
+
+	// data[0] is found, data[1] is created and data[2] shares the id of data[0].
+	if results, err = db.BatchCreateOrGet(data); err != nil {
+		goto end
+	}
+
+	for _, r := range results {
+		log.Printf("id: %v, created: %v\n", r.ID, r.Created)
+	}
+
+	ids = append(ids, results[0].ID, results[1].ID)
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- BatchCreateOrGet() Test End --------\n")
+	// Output:
+}
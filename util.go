@@ -28,6 +28,33 @@ end:
 	return redisHashMaxZiplistEntries, nil
 }
 
+// GetRedisHashMaxZiplistValue gets the Redis "hash-max-ziplist-value" config value.
+// It reads "hash-max-listpack-value" if "hash-max-ziplist-value" is not found(Redis 7.0 renamed it).
+func GetRedisHashMaxZiplistValue(c redis.Conn) (redisHashMaxZiplistValue uint64, err error) {
+	config := map[string]string{}
+	v, ok := "", false
+
+	if config, err = redishelper.GetConfig(c); err != nil {
+		goto end
+	}
+
+	if v, ok = config["hash-max-ziplist-value"]; !ok {
+		v = config["hash-max-listpack-value"]
+	}
+
+	if redisHashMaxZiplistValue, err = strconv.ParseUint(v, 10, 64); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("GetRedisHashMaxZiplistValue() error: %v\n", err)
+		return 0, err
+	}
+
+	return redisHashMaxZiplistValue, nil
+}
+
 // GetRedisConn gets the Redis connection.
 func GetRedisConn(redisAddr, redisPassword string) (c redis.Conn, err error) {
 	pongStr := ""
@@ -34,6 +34,33 @@ end:
 	// Output:
 }
 
+func ExampleGetRedisHashMaxZiplistValue() {
+	var err error
+	var c redis.Conn
+	var redisHashMaxZiplistValue uint64 = 0
+
+	log.Printf("\n")
+	log.Printf("--------- GetRedisHashMaxZiplistValue() Test Begin --------\n")
+
+	if c, err = redis.Dial("tcp", ":6379"); err != nil {
+		goto end
+	}
+	defer c.Close()
+
+	if redisHashMaxZiplistValue, err = simpledb.GetRedisHashMaxZiplistValue(c); err != nil {
+		goto end
+	}
+
+	log.Printf("Redis hash-max-ziplist-value: %v\n", redisHashMaxZiplistValue)
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+
+	log.Printf("--------- GetRedisHashMaxZiplistValue() Test End --------\n")
+	// Output:
+}
+
 func ExampleGetRedisConn() {
 	var err error
 	var c redis.Conn
@@ -0,0 +1,340 @@
+package simpledb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Validator validates record data. It returns nil if the data is valid.
+// It may return *ValidationError to identify the invalid field.
+type Validator func(data string) error
+
+// ValidationError is returned when record data fails the validation.
+type ValidationError struct {
+	// Index is the order of the item in the batch. It's 0 for single record operations.
+	Index int
+	// Field is the path of the invalid field. Ex: "name", "address.city", "tags[1]". It's empty if the whole data is invalid.
+	Field string
+	// Err is the reason.
+	Err error
+}
+
+// Error returns the error message.
+func (e *ValidationError) Error() string {
+	if len(e.Field) == 0 {
+		return fmt.Sprintf("Validation failed for item %v: %v", e.Index, e.Err)
+	}
+	return fmt.Sprintf("Validation failed for item %v, field %v: %v", e.Index, e.Field, e.Err)
+}
+
+// Unwrap returns the reason.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// SetValidator sets the validator of record data. Validation is disabled if v is nil.
+// Data is validated by Create, BatchCreate, Update, BatchUpdate and their variants before written.
+func (db *DB) SetValidator(v Validator) {
+	db.validator = v
+}
+
+// SetSchema sets a JSON Schema as the validator of record data. See ParseSchema for supported keywords.
+func (db *DB) SetSchema(schema string) (err error) {
+	var s *Schema
+
+	if s, err = ParseSchema(schema); err != nil {
+		debugPrintf("SetSchema() error: %v\n", err)
+		return err
+	}
+
+	db.SetValidator(s.Validate)
+	return nil
+}
+
+// validate validates data of the i-th item in the batch.
+// The size of the data is checked by checkDataSize() separately.
+func (db *DB) validate(i int, data string) error {
+	var ve *ValidationError
+
+	if db.validator == nil {
+		return nil
+	}
+
+	err := db.validator(data)
+	if err == nil {
+		return nil
+	}
+
+	if errors.As(err, &ve) {
+		return &ValidationError{Index: i, Field: ve.Field, Err: ve.Err}
+	}
+	return &ValidationError{Index: i, Err: err}
+}
+
+// validateAll validates the data array. Error of each item is stored in errs. Empty data is not validated.
+func (db *DB) validateAll(dataArr []string) (errs []error) {
+	for i, data := range dataArr {
+		if len(data) == 0 {
+			errs = append(errs, nil)
+			continue
+		}
+		errs = append(errs, db.validate(i, data))
+	}
+	return errs
+}
+
+// Schema is a subset of JSON Schema to validate record data.
+//
+//	Supported keywords:
+//	    type: "object", "array", "string", "number", "integer", "boolean" or "null".
+//	    properties, required: for objects.
+//	    items, minItems, maxItems: for arrays.
+//	    minLength, maxLength(in characters), pattern(Go regexp syntax): for strings.
+//	    enum: for all types.
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+	MinLength  *int               `json:"minLength,omitempty"`
+	MaxLength  *int               `json:"maxLength,omitempty"`
+	Pattern    string             `json:"pattern,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+	// re is the compiled pattern.
+	re *regexp.Regexp
+}
+
+// ParseSchema parses the JSON Schema.
+func ParseSchema(schema string) (s *Schema, err error) {
+	s = &Schema{}
+
+	if err = json.Unmarshal([]byte(schema), s); err != nil {
+		goto end
+	}
+
+	if err = s.compile(""); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("ParseSchema() error: %v\n", err)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// compile checks the schema and compiles the patterns recursively.
+func (s *Schema) compile(path string) (err error) {
+	switch s.Type {
+	case "", "object", "array", "string", "number", "integer", "boolean", "null":
+	default:
+		return fmt.Errorf("Unsupported type of %v: %v.", schemaPath(path), s.Type)
+	}
+
+	if len(s.Pattern) != 0 {
+		if s.re, err = regexp.Compile(s.Pattern); err != nil {
+			return fmt.Errorf("Invalid pattern of %v: %v", schemaPath(path), err)
+		}
+	}
+
+	for i, v := range s.Enum {
+		s.Enum[i] = normalizeJSON(v)
+	}
+
+	for name, p := range s.Properties {
+		if p == nil {
+			return fmt.Errorf("Empty schema of %v.", schemaPath(joinFieldPath(path, name)))
+		}
+
+		if err = p.compile(joinFieldPath(path, name)); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		if err = s.Items.compile(path + "[]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate validates record data. It returns *ValidationError if the data is invalid.
+// It can be used as a Validator.
+func (s *Schema) Validate(data string) error {
+	var v interface{}
+
+	d := json.NewDecoder(bytes.NewReader([]byte(data)))
+	d.UseNumber()
+
+	if err := d.Decode(&v); err != nil {
+		return &ValidationError{Err: fmt.Errorf("Invalid JSON: %v", err)}
+	}
+
+	// Only one JSON value is allowed. Ex: `{"a":1} garbage` and `{"a":1}{"b":2}` are invalid.
+	if _, err := d.Token(); err != io.EOF {
+		return &ValidationError{Err: fmt.Errorf("Invalid JSON: unexpected data after the JSON value.")}
+	}
+
+	return s.validate("", v)
+}
+
+// validate validates the value of the field recursively.
+func (s *Schema) validate(path string, v interface{}) error {
+	fail := func(format string, a ...interface{}) error {
+		return &ValidationError{Field: path, Err: fmt.Errorf(format, a...)}
+	}
+
+	if len(s.Type) != 0 && !matchType(s.Type, v) {
+		return fail("Type should be %v.", s.Type)
+	}
+
+	if len(s.Enum) != 0 {
+		nv := normalizeJSON(v)
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(e, nv) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fail("Value is not in enum.")
+		}
+	}
+
+	switch t := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("Length should be >= %v.", *s.MinLength)
+		}
+
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("Length should be <= %v.", *s.MaxLength)
+		}
+
+		if s.re != nil && !s.re.MatchString(t) {
+			return fail("Value does not match pattern: %v.", s.Pattern)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(t) < *s.MinItems {
+			return fail("Item number should be >= %v.", *s.MinItems)
+		}
+
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			return fail("Item number should be <= %v.", *s.MaxItems)
+		}
+
+		if s.Items != nil {
+			for i, item := range t {
+				if err := s.Items.validate(path+"["+strconv.Itoa(i)+"]", item); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := t[name]; !ok {
+				return &ValidationError{Field: joinFieldPath(path, name), Err: fmt.Errorf("Field is required.")}
+			}
+		}
+
+		// Validate properties in order to return the same error for the same data.
+		names := []string{}
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if fv, ok := t[name]; ok {
+				if err := s.Properties[name].validate(joinFieldPath(path, name), fv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchType checks if the decoded JSON value matches the type of JSON Schema.
+func matchType(typ string, v interface{}) bool {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return typ == "object"
+	case []interface{}:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case nil:
+		return typ == "null"
+	case json.Number:
+		if typ == "number" {
+			return true
+		}
+
+		if typ == "integer" {
+			if _, err := t.Int64(); err == nil {
+				return true
+			}
+			f, err := t.Float64()
+			return err == nil && f == math.Trunc(f)
+		}
+	}
+	return false
+}
+
+// normalizeJSON converts numbers of the decoded JSON value to float64 recursively so that values can be compared.
+func normalizeJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case []interface{}:
+		a := make([]interface{}, len(t))
+		for i, item := range t {
+			a[i] = normalizeJSON(item)
+		}
+		return a
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			m[k] = normalizeJSON(item)
+		}
+		return m
+	}
+	return v
+}
+
+// joinFieldPath appends the field name to the path.
+func joinFieldPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// schemaPath returns the path used in schema error messages.
+func schemaPath(path string) string {
+	if len(path) == 0 {
+		return "root"
+	}
+	return path
+}
@@ -0,0 +1,62 @@
+package simpledb_test
+
+import (
+	"errors"
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_SetSchema() {
+	var err error
+	var db *simpledb.DB
+	var ve *simpledb.ValidationError
+
+	log.Printf("\n")
+	log.Printf("--------- SetSchema() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "validate-test")
+	defer db.Close()
+
+	if err = db.SetSchema(`{
+		"type": "object",
+		"required": ["name", "tel"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1, "maxLength": 32},
+			"tel": {"type": "string", "pattern": "^[0-9]{11}$"},
+			"sex": {"enum": ["male", "female"]}
+		}
+	}`); err != nil {
+		goto end
+	}
+
+	// The second item has an invalid tel. No record is created.
+	if _, err = db.BatchCreate([]string{
+		`{"name":"Alice","tel":"13800138201","sex":"female"}`,
+		`{"name":"Bob","tel":"1380013820"}`,
+	}); err != nil {
+		if errors.As(err, &ve) {
+			log.Printf("validation error: item: %v, field: %v, reason: %v\n", ve.Index, ve.Field, ve.Err)
+			err = nil
+		} else {
+			goto end
+		}
+	}
+
+	// Data after the JSON value is invalid.
+	if _, err = db.Create(`{"name":"Carl","tel":"13800138202"} garbage`); err != nil {
+		if errors.As(err, &ve) {
+			log.Printf("validation error: field: %q, reason: %v\n", ve.Field, ve.Err)
+			err = nil
+		} else {
+			goto end
+		}
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- SetSchema() Test End --------\n")
+	// Output:
+}
@@ -0,0 +1,149 @@
+package simpledb
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// ConflictError is returned by UpdateIfVersion() and UpdateIfData() when the record has been changed by others.
+type ConflictError struct {
+	// ID is record ID.
+	ID string
+	// Version is the current version of the record.
+	Version uint64
+}
+
+// Error returns the error message.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("Record %v has been changed, current version: %v.", e.ID, e.Version)
+}
+
+// genVersionHashKey generates the version hash(bucket) key by given record id.
+// Versions are stored in buckets which have the same bucket id as the record buckets.
+func (db *DB) genVersionHashKey(id uint64) string {
+	bucketID := db.computeBucketID(id)
+	return fmt.Sprintf("%v/ver/bucket/%v", db.name, bucketID)
+}
+
+// getVersion gets the version of given record id in a transaction.
+// Records created before versioning are of version 0.
+func (db *DB) getVersion(id uint64) (version uint64, err error) {
+	if version, err = redis.Uint64(db.c.Do("HGET", db.genVersionHashKey(id), id)); err != nil {
+		if err == redis.ErrNil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return version, nil
+}
+
+// GetVersion returns the version of the record.
+// Version starts from 1 when a record is created and increases by 1 for each update which changes the data.
+func (db *DB) GetVersion(id string) (version uint64, err error) {
+	var r Record
+
+	if r, version, err = db.GetWithVersion(id); err != nil {
+		debugPrintf("GetVersion() error: %v\n", err)
+		return 0, err
+	}
+
+	debugPrintf("GetVersion() ok. id: %v, version: %v\n", r.ID, version)
+	return version, nil
+}
+
+// GetWithVersion returns the record and its version atomically.
+// The version can be passed to UpdateIfVersion() for optimistic concurrency control.
+func (db *DB) GetWithVersion(id string) (r Record, version uint64, err error) {
+	var nID uint64
+	var v []interface{}
+	var data interface{}
+	alreadySendMULTI := false
+
+	if nID, err = strconv.ParseUint(id, 10, 64); err != nil {
+		goto end
+	}
+
+	db.c.Send("MULTI")
+	alreadySendMULTI = true
+	db.c.Send("HGET", db.genRecordHashKey(nID), nID)
+	db.c.Send("HGET", db.genVersionHashKey(nID), nID)
+
+	if v, err = redis.Values(db.c.Do("EXEC")); err != nil {
+		goto end
+	}
+	alreadySendMULTI = false
+
+	if v, err = redis.Scan(v, &data, &version); err != nil {
+		goto end
+	}
+
+	if data == nil {
+		err = fmt.Errorf("Id: %v does not exist.", id)
+		goto end
+	}
+
+	if r.Data, err = redis.String(data, nil); err != nil {
+		goto end
+	}
+
+	if r.Data, err = db.decodeData(r.Data); err != nil {
+		goto end
+	}
+	r.ID = id
+
+end:
+	if err != nil {
+		if alreadySendMULTI {
+			db.c.Do("DISCARD")
+		}
+		debugPrintf("GetWithVersion() error: %v\n", err)
+		return Record{}, 0, err
+	}
+
+	return r, version, nil
+}
+
+// UpdateIfVersion updates the record only if its current version equals expectedVersion.
+// It fails with *ConflictError if the record has been changed.
+// The version check and the update are done in one transaction.
+func (db *DB) UpdateIfVersion(id, data string, expectedVersion uint64) (err error) {
+	if _, err = db.update(OpUpdate, []Record{{ID: id, Data: data}}, false, func(nID uint64, oldData string) error {
+		version, err := db.getVersion(nID)
+		if err != nil {
+			return err
+		}
+
+		if version != expectedVersion {
+			return &ConflictError{ID: id, Version: version}
+		}
+		return nil
+	}); err != nil {
+		debugPrintf("UpdateIfVersion() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateIfData updates the record with newData only if its current data equals oldData(compare-and-swap).
+// It fails with *ConflictError if the record has been changed.
+// The data check and the update are done in one transaction.
+func (db *DB) UpdateIfData(id, oldData, newData string) (err error) {
+	if _, err = db.update(OpUpdate, []Record{{ID: id, Data: newData}}, false, func(nID uint64, currentData string) error {
+		if currentData != oldData {
+			version, err := db.getVersion(nID)
+			if err != nil {
+				return err
+			}
+			return &ConflictError{ID: id, Version: version}
+		}
+		return nil
+	}); err != nil {
+		debugPrintf("UpdateIfData() error: %v\n", err)
+		return err
+	}
+
+	return nil
+}
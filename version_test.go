@@ -0,0 +1,100 @@
+package simpledb_test
+
+import (
+	"errors"
+	"log"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_UpdateIfVersion() {
+	var err error
+	var db *simpledb.DB
+	var version uint64
+	var conflictErr *simpledb.ConflictError
+	id := ""
+	record := simpledb.Record{}
+
+	log.Printf("\n")
+	log.Printf("--------- UpdateIfVersion() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "version-test")
+	defer db.Close()
+
+	if id, err = db.Create(`{"name":"Lily","tel":"13900139031"}`); err != nil {
+		goto end
+	}
+
+	if record, version, err = db.GetWithVersion(id); err != nil {
+		goto end
+	}
+	log.Printf("id: %v, data: %v, version: %v\n", record.ID, record.Data, version)
+
+	// The first update succeeds and increases the version.
+	if err = db.UpdateIfVersion(id, `{"name":"Lily","tel":"18900189031"}`, version); err != nil {
+		goto end
+	}
+
+	// The second update with the old version fails.
+	err = db.UpdateIfVersion(id, `{"name":"Lily","tel":"18600186031"}`, version)
+	if errors.As(err, &conflictErr) {
+		log.Printf("conflict: id: %v, current version: %v\n", conflictErr.ID, conflictErr.Version)
+		err = nil
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- UpdateIfVersion() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_UpdateIfData() {
+	var err error
+	var db *simpledb.DB
+	var version uint64
+	id := ""
+	oldData := `{"name":"Mike","tel":"13900139032"}`
+	newData := `{"name":"Mike","tel":"18900189032"}`
+
+	log.Printf("\n")
+	log.Printf("--------- UpdateIfData() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "version-test")
+	defer db.Close()
+
+	if id, err = db.Create(oldData); err != nil {
+		goto end
+	}
+
+	if err = db.UpdateIfData(id, oldData, newData); err != nil {
+		goto end
+	}
+
+	// oldData has been replaced.
+	if err = db.UpdateIfData(id, oldData, `{"name":"Mike","tel":"18600186032"}`); err != nil {
+		log.Printf("UpdateIfData() error as expected: %v\n", err)
+		err = nil
+	}
+
+	if version, err = db.GetVersion(id); err != nil {
+		goto end
+	}
+	log.Printf("id: %v, version: %v\n", id, version)
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- UpdateIfData() Test End --------\n")
+	// Output:
+}
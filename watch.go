@@ -0,0 +1,326 @@
+package simpledb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// changeMessage is the JSON format of a change published to the watch channel.
+type changeMessage struct {
+	Op      ChangeOp `json:"op"`
+	ID      string   `json:"id"`
+	OldData string   `json:"old"`
+	NewData string   `json:"new"`
+}
+
+// SetWatchNotify sets watch notify mode.
+// In watch notify mode, every create, update and delete publishes the change to the watch channel of the DB(Redis Pub/Sub)
+// in the same transaction. Changes can be received by Watch() and WatchPattern().
+// Pub/Sub is fire-and-forget: changes published when no watcher is connected are lost. Use the change feed for reliable processing.
+func (db *DB) SetWatchNotify(on bool) {
+	db.watchNotify = on
+}
+
+// genWatchChannel generates the Pub/Sub channel name for watch notifications.
+func (db *DB) genWatchChannel() string {
+	return fmt.Sprintf("%v/watch", db.name)
+}
+
+// queuePublish queues the command to publish a change to the watch channel in the transaction.
+// It's a no-op if watch notify mode is disabled.
+func (db *DB) queuePublish(t *tx, op ChangeOp, id uint64, oldData, newData string) {
+	if !db.watchNotify {
+		return
+	}
+
+	buf, err := json.Marshal(changeMessage{Op: op, ID: strconv.FormatUint(id, 10), OldData: oldData, NewData: newData})
+	if err != nil {
+		debugPrintf("queuePublish() error: %v\n", err)
+		return
+	}
+	t.send("PUBLISH", db.genWatchChannel(), buf)
+}
+
+// Watcher receives change notifications of watched records.
+type Watcher struct {
+	// C delivers the changes. It's closed when the context is canceled or an error occurs.
+	C <-chan Change
+	c chan Change
+	// match checks if a change should be delivered.
+	match func(change Change) bool
+	// decrypt decrypts the record data of a change for encrypted databases.
+	decrypt func(change *Change) error
+	mu      sync.Mutex
+	err     error
+}
+
+// Err returns the error which ends the watcher. It should be called after C is closed.
+// It returns nil if the watcher is ended by canceling the context.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// run receives messages from the watch channel until the context is canceled or an error occurs.
+func (w *Watcher) run(ctx context.Context, psc *redis.PubSubConn) {
+	var msg changeMessage
+	var err error
+	var change Change
+	done := make(chan struct{})
+
+	defer func() {
+		close(done)
+		w.mu.Lock()
+		w.err = err
+		w.mu.Unlock()
+
+		psc.Close()
+		close(w.c)
+	}()
+
+	// Unsubscribe when ctx is canceled. It makes Receive() return a subscription message with count 0.
+	go func() {
+		select {
+		case <-ctx.Done():
+			psc.Unsubscribe()
+		case <-done:
+		}
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			msg = changeMessage{}
+			if err = json.Unmarshal(v.Data, &msg); err != nil {
+				debugPrintf("Watcher.run() error: %v\n", err)
+				return
+			}
+
+			change = Change{Op: msg.Op, ID: msg.ID, OldData: msg.OldData, NewData: msg.NewData}
+			if err = w.decrypt(&change); err != nil {
+				debugPrintf("Watcher.run() error: %v\n", err)
+				return
+			}
+
+			if !w.match(change) {
+				continue
+			}
+
+			select {
+			case w.c <- change:
+			case <-ctx.Done():
+				return
+			}
+		case redis.Subscription:
+			if v.Count == 0 {
+				return
+			}
+		case error:
+			// Receive() returns error after the connection is closed when ctx is canceled.
+			if ctx.Err() == nil {
+				err = v
+				debugPrintf("Watcher.run() error: %v\n", err)
+			}
+			return
+		}
+	}
+}
+
+// watchChanges creates a watcher with a dedicated Redis connection. Changes are delivered if match returns true.
+func (db *DB) watchChanges(ctx context.Context, match func(change Change) bool) (w *Watcher, err error) {
+	var c redis.Conn
+	var psc *redis.PubSubConn
+	ch := make(chan Change)
+
+	if c, err = GetRedisConn(db.redisAddr, db.redisPassword); err != nil {
+		return nil, err
+	}
+
+	psc = &redis.PubSubConn{Conn: c}
+	if err = psc.Subscribe(db.genWatchChannel()); err != nil {
+		psc.Close()
+		return nil, err
+	}
+
+	w = &Watcher{C: ch, c: ch, match: match, decrypt: db.decryptChange}
+	go w.run(ctx, psc)
+	return w, nil
+}
+
+// Watch watches the changes of given records.
+//
+//	Params:
+//	    ctx: the watcher ends when ctx is canceled.
+//	    ids: record ids to watch.
+//
+// Changes are published only when watch notify mode is set by SetWatchNotify() on the DB instances which write records.
+func (db *DB) Watch(ctx context.Context, ids ...string) (w *Watcher, err error) {
+	watchedIDs := make(map[string]struct{})
+
+	if len(ids) == 0 {
+		err = fmt.Errorf("Empty id array")
+		goto end
+	}
+
+	for _, id := range ids {
+		watchedIDs[id] = struct{}{}
+	}
+
+	if w, err = db.watchChanges(ctx, func(change Change) bool {
+		_, ok := watchedIDs[change.ID]
+		return ok
+	}); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		debugPrintf("Watch() error: %v\n", err)
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WatchPattern watches the changes of records which match the pattern.
+//
+//	Params:
+//	    ctx: the watcher ends when ctx is canceled.
+//	    pattern: glob-style pattern the same as the pattern of Search(). Ex: `*"name":"Frank*"*`.
+//	             A change is delivered if the old or new data matches the pattern.
+//
+// Changes are published only when watch notify mode is set by SetWatchNotify() on the DB instances which write records.
+func (db *DB) WatchPattern(ctx context.Context, pattern string) (w *Watcher, err error) {
+	if err = db.checkSearch(); err != nil {
+		debugPrintf("WatchPattern() error: %v\n", err)
+		return nil, err
+	}
+
+	if w, err = db.watchChanges(ctx, func(change Change) bool {
+		return (len(change.OldData) != 0 && globMatch(pattern, change.OldData)) ||
+			(len(change.NewData) != 0 && globMatch(pattern, change.NewData))
+	}); err != nil {
+		debugPrintf("WatchPattern() error: %v\n", err)
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// globMatch reports whether s matches the glob-style pattern in the same way as Redis(SCAN / KEYS MATCH).
+// Supported: "*", "?", "[abc]", "[^abc]", "[a-z]" and "\" to escape special characters.
+func globMatch(pattern, s string) bool {
+	p := []rune(pattern)
+	r := []rune(s)
+
+	// Index of the last "*" in p and the position in r it matches to, used for backtracking.
+	star, match := -1, 0
+	i, j := 0, 0
+
+	for j < len(r) {
+		if i < len(p) {
+			switch p[i] {
+			case '*':
+				star, match = i, j
+				i++
+				continue
+			case '?':
+				i++
+				j++
+				continue
+			case '[':
+				if next, ok := matchClass(p, i, r[j]); next > 0 {
+					if ok {
+						i = next
+						j++
+						continue
+					}
+				} else if p[i] == r[j] {
+					// Unterminated class: match "[" literally.
+					i++
+					j++
+					continue
+				}
+			case '\\':
+				if i+1 < len(p) && p[i+1] == r[j] {
+					i += 2
+					j++
+					continue
+				} else if i+1 == len(p) && r[j] == '\\' {
+					i++
+					j++
+					continue
+				}
+			default:
+				if p[i] == r[j] {
+					i++
+					j++
+					continue
+				}
+			}
+		}
+
+		// Mismatch: backtrack to the last "*" and let it match one more rune.
+		if star < 0 {
+			return false
+		}
+		i = star + 1
+		match++
+		j = match
+	}
+
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// matchClass matches c against the character class starting at p[start] == '['.
+// It returns the index after the closing "]" and whether c is in the class. next is 0 if the class is unterminated.
+func matchClass(p []rune, start int, c rune) (next int, ok bool) {
+	i := start + 1
+	not := false
+
+	if i < len(p) && p[i] == '^' {
+		not = true
+		i++
+	}
+
+	for ; i < len(p) && p[i] != ']'; i++ {
+		switch {
+		case p[i] == '\\' && i+1 < len(p):
+			i++
+			if p[i] == c {
+				ok = true
+			}
+		case i+2 < len(p) && p[i+1] == '-' && p[i+2] != ']':
+			lo, hi := p[i], p[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				ok = true
+			}
+			i += 2
+		default:
+			if p[i] == c {
+				ok = true
+			}
+		}
+	}
+
+	if i >= len(p) {
+		return 0, false
+	}
+
+	if not {
+		ok = !ok
+	}
+	return i + 1, ok
+}
@@ -0,0 +1,101 @@
+package simpledb_test
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/northbright/simpledb"
+)
+
+func ExampleDB_Watch() {
+	var err error
+	var db *simpledb.DB
+	var w *simpledb.Watcher
+	id := ""
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	log.Printf("\n")
+	log.Printf("--------- Watch() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "watch-test")
+	defer db.Close()
+
+	db.SetWatchNotify(true)
+
+	if id, err = db.Create(`{"name":"Tina","tel":"13900139081"}`); err != nil {
+		goto end
+	}
+
+	if w, err = db.Watch(ctx, id); err != nil {
+		goto end
+	}
+
+	if err = db.Update(simpledb.Record{ID: id, Data: `{"name":"Tina","tel":"18900189081"}`}); err != nil {
+		goto end
+	}
+
+	if err = db.Delete(id); err != nil {
+		goto end
+	}
+
+	for i := 0; i < 2; i++ {
+		change, ok := <-w.C
+		if !ok {
+			break
+		}
+		log.Printf("op: %v, id: %v, old: %v, new: %v\n", change.Op, change.ID, change.OldData, change.NewData)
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- Watch() Test End --------\n")
+	// Output:
+}
+
+func ExampleDB_WatchPattern() {
+	var err error
+	var db *simpledb.DB
+	var w *simpledb.Watcher
+	ids := []string{}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	log.Printf("\n")
+	log.Printf("--------- WatchPattern() Test Begin --------\n")
+
+	db, _ = simpledb.Open(":6379", "", "watch-test")
+	defer db.Close()
+
+	db.SetWatchNotify(true)
+
+	if w, err = db.WatchPattern(ctx, `*"name":"U*"*`); err != nil {
+		goto end
+	}
+
+	// Only the first record matches the pattern.
+	if ids, err = db.BatchCreate([]string{
+		`{"name":"Uma","tel":"13900139082"}`,
+		`{"name":"Vic","tel":"13900139083"}`,
+	}); err != nil {
+		goto end
+	}
+
+	if change, ok := <-w.C; ok {
+		log.Printf("op: %v, id: %v, new: %v\n", change.Op, change.ID, change.NewData)
+	}
+
+	if err = db.BatchDelete(ids); err != nil {
+		goto end
+	}
+
+end:
+	if err != nil {
+		log.Printf("error: %v\n", err)
+	}
+	log.Printf("--------- WatchPattern() Test End --------\n")
+	// Output:
+}